@@ -19,6 +19,8 @@ type configuration struct {
     InPort int
     OutPort int
     QueueParameters queueParameters
+    // nonce acceptance window in seconds
+    NonceWindow int
 }
 
 func loadConfiguration(configFileName string) (*configuration, error) {
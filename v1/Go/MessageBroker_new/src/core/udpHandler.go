@@ -2,20 +2,20 @@ package core
 
 import (
 	"bytes"
-	"encoding/binary"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net"
+	"nonce"
 	"strconv"
 	"strings"
-	"time"
 )
 
 type Server struct {
 	key []byte
 	conn *net.UDPConn
 	q *queue
+	nonces *nonce.Cache
 }
 
 func UDPServerStart(q *queue) error {
@@ -35,7 +35,7 @@ func UDPServerStart(q *queue) error {
 		return err
 	}
 
-	server := Server{key, conn, q}
+	server := Server{key, conn, q, nonce.NewCache(q.config.NonceWindow)}
 
 	fmt.Printf("UDP server started on port %d\n", q.config.OutPort)
 
@@ -52,7 +52,7 @@ func serverLoop(server *Server) {
 		if err != nil {
 			log.Println(err)
 		} else {
-			go handle(server, addr, buffer[:n])
+			go handle(server, addr, append([]byte(nil), buffer[:n]...))
 		}
 	}
 }
@@ -67,15 +67,14 @@ func logRequest(addr net.Addr) {
 
 func handle(server *Server, addr net.Addr, data []byte) {
 	logRequest(addr)
-	decodedData, err := AesDecode(data, server.key, false, func(nonce []byte) error {
-		timePart := binary.LittleEndian.Uint64(nonce[len(nonce)-8:]) >> 16
-		millis := uint64(time.Now().UnixNano() / 1000000)
-		if (timePart >= millis && (timePart-millis < 60000)) ||
-			(timePart < millis && (millis-timePart < 60000)) { // 60 seconds
-			return nil
-		}
-		return fmt.Errorf("incorrect nonce")
+	var nonce []byte
+	decodedData, err := AesDecode(data, server.key, false, func(n []byte) error {
+		nonce = n
+		return server.nonces.CheckTime(n)
 	})
+	if err == nil {
+		err = server.nonces.Add(nonce)
+	}
 	if err != nil {
 		logError(err.Error())
 		return
@@ -19,6 +19,7 @@ type configuration struct {
     KeyFile                 string
     key                     []byte
     UdpPort                 int
+    NonceWindow             int
 }
 
 var config configuration
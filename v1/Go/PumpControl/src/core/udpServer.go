@@ -1,16 +1,19 @@
 package core
 
 import (
-    "encoding/binary"
     "encoding/json"
     "fmt"
     "log"
     "net"
+    "nonce"
     "strings"
-    "time"
 )
 
+var nonces *nonce.Cache
+
 func serverStart() error {
+    nonces = nonce.NewCache(config.NonceWindow)
+
     addr := net.UDPAddr{Port: config.UdpPort}
     conn, err := net.ListenUDP("udp", &addr)
     if err != nil {
@@ -37,7 +40,7 @@ func serverLoop(conn *net.UDPConn) {
         if err != nil {
             logError(err.Error())
         } else {
-            go handle(conn, addr, buffer[:n])
+            go handle(conn, addr, append([]byte(nil), buffer[:n]...))
         }
     }
 }
@@ -66,15 +69,14 @@ func activateHandler() {
 
 func handle(conn *net.UDPConn, addr net.Addr, data []byte) {
     logRequest(addr)
-    decodedData, err := AesDecode(data, config.key, false, func(nonce []byte) error {
-        timePart := binary.LittleEndian.Uint64(nonce[len(nonce)-8:]) >> 16
-        millis := uint64(time.Now().UnixNano() / 1000000)
-        if (timePart >= millis && (timePart-millis < 60000)) ||
-            (timePart < millis && (millis-timePart < 60000)) { // 60 seconds
-            return nil
-        }
-        return fmt.Errorf("incorrect nonce")
+    var nonce []byte
+    decodedData, err := AesDecode(data, config.key, false, func(n []byte) error {
+        nonce = n
+        return nonces.CheckTime(n)
     })
+    if err == nil {
+        err = nonces.Add(nonce)
+    }
     if err != nil {
         logError(err.Error())
         return
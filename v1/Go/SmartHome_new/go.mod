@@ -1,3 +1,7 @@
 module smartHome
 
 go 1.20
+
+require nonce v0.0.0
+
+replace nonce => ../common/src/nonce
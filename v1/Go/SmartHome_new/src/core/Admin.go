@@ -0,0 +1,220 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"smartHome/src/core/entities"
+	"strconv"
+	"strings"
+)
+
+// Admin commands:
+//   POST /sensors <sensor json>, PUT /sensors/<id> <sensor json>, DELETE /sensors/<id>
+//   POST /locations <location json>, PUT /locations/<id> <location json>, DELETE /locations/<id>
+// POST with zero id uses next free id. The response is the added, updated or deleted object.
+// When AdminKeyFileName is set, admin commands should be encrypted with the admin key.
+
+func badRequest(format string, args ...any) error {
+	return fmt.Errorf("400 Bad request: "+format, args...)
+}
+
+func notFound(format string, args ...any) error {
+	return fmt.Errorf("404 Not found: "+format, args...)
+}
+
+// returns id from /<id> path, 0 for empty path
+func parseAdminId(path string) (int, error) {
+	if len(path) == 0 {
+		return 0, nil
+	}
+	id, err := strconv.Atoi(strings.TrimPrefix(path, "/"))
+	if err != nil || path[0] != '/' || id <= 0 {
+		return 0, badRequest("invalid id %v", path)
+	}
+	return id, nil
+}
+
+func checkAdminRequest(method string, id int) error {
+	switch method {
+	case "POST":
+		if id != 0 {
+			return badRequest("id is not allowed for POST")
+		}
+	case "PUT", "DELETE":
+		if id == 0 {
+			return badRequest("id is required for %v", method)
+		}
+	default:
+		return badRequest("invalid method %v", method)
+	}
+	return nil
+}
+
+func nextId[V any](m map[int]V) int {
+	maxId := 0
+	for id := range m {
+		if id > maxId {
+			maxId = id
+		}
+	}
+	return maxId + 1
+}
+
+// updates sensors map, returns added, updated or deleted sensor
+func updateSensors(sensors map[int]entities.Sensor, method string, path string, body []byte) (any, error) {
+	id, err := parseAdminId(path)
+	if err != nil {
+		return nil, err
+	}
+	err = checkAdminRequest(method, id)
+	if err != nil {
+		return nil, err
+	}
+	old, exists := sensors[id]
+	if id != 0 && !exists {
+		return nil, notFound("sensor %v", id)
+	}
+	if method == "DELETE" {
+		delete(sensors, id)
+		return old, nil
+	}
+	var sensor entities.Sensor
+	err = json.Unmarshal(body, &sensor)
+	if err != nil {
+		return nil, badRequest("sensor json parsing error: %v", err.Error())
+	}
+	if method == "POST" {
+		if sensor.Id == 0 {
+			sensor.Id = nextId(sensors)
+		}
+		_, ok := sensors[sensor.Id]
+		if ok {
+			return nil, badRequest("sensor %v already exists", sensor.Id)
+		}
+	} else if sensor.Id == 0 {
+		sensor.Id = id
+	} else if sensor.Id != id {
+		return nil, badRequest("sensor id %v does not match %v", sensor.Id, id)
+	}
+	if sensor.Id <= 0 || len(sensor.Name) == 0 || len(sensor.DataType) == 0 {
+		return nil, badRequest("sensor id, name and data type are required")
+	}
+	err = sensor.Validate()
+	if err != nil {
+		return nil, badRequest(err.Error())
+	}
+	sensors[sensor.Id] = sensor
+	return sensor, nil
+}
+
+// updates locations map, returns added, updated or deleted location
+func updateLocations(locations map[int]entities.Location, method string, path string, body []byte) (any, error) {
+	id, err := parseAdminId(path)
+	if err != nil {
+		return nil, err
+	}
+	err = checkAdminRequest(method, id)
+	if err != nil {
+		return nil, err
+	}
+	old, exists := locations[id]
+	if id != 0 && !exists {
+		return nil, notFound("location %v", id)
+	}
+	if method == "DELETE" {
+		delete(locations, id)
+		return old, nil
+	}
+	var location entities.Location
+	err = json.Unmarshal(body, &location)
+	if err != nil {
+		return nil, badRequest("location json parsing error: %v", err.Error())
+	}
+	if method == "POST" {
+		if location.Id == 0 {
+			location.Id = nextId(locations)
+		}
+		_, ok := locations[location.Id]
+		if ok {
+			return nil, badRequest("location %v already exists", location.Id)
+		}
+	} else if location.Id == 0 {
+		location.Id = id
+	} else if location.Id != id {
+		return nil, badRequest("location id %v does not match %v", location.Id, id)
+	}
+	err = location.Validate()
+	if err != nil {
+		return nil, badRequest(err.Error())
+	}
+	locations[location.Id] = location
+	return location, nil
+}
+
+// validates metadata change, writes json files and updates DB
+func (a *DB) updateMetadata(dataFolder string, method string, path string, body []byte) ([]byte, error) {
+	a.metadataMutex.Lock()
+	defer a.metadataMutex.Unlock()
+
+	sensors := make(map[int]entities.Sensor)
+	locations := make(map[int]entities.Location)
+	a.mutex.RLock()
+	for id, sensor := range a.Sensors {
+		sensors[id] = sensor
+	}
+	for id, location := range a.Locations {
+		locations[id] = location
+	}
+	a.mutex.RUnlock()
+
+	var result any
+	var err error
+	sensorsChanged := false
+	if path == "/sensors" || strings.HasPrefix(path, "/sensors/") {
+		result, err = updateSensors(sensors, method, path[8:], body)
+		sensorsChanged = true
+	} else if path == "/locations" || strings.HasPrefix(path, "/locations/") {
+		result, err = updateLocations(locations, method, path[10:], body)
+	} else {
+		err = notFound("%v", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = entities.ValidateSensors(sensors)
+	if err == nil {
+		err = validateMetadata(sensors, locations)
+	}
+	if err != nil {
+		return nil, badRequest(err.Error())
+	}
+
+	if sensorsChanged {
+		err = entities.WriteSensorsToJson(dataFolder+string(os.PathSeparator)+"sensors.json", sensors)
+	} else {
+		err = entities.WriteLocationsToJson(dataFolder+string(os.PathSeparator)+"locations.json", locations)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("500 File write error: %v", err.Error())
+	}
+	a.setMetadata(sensors, locations)
+	return json.Marshal(result)
+}
+
+func AdminHandler(server *Server, w *bytes.Buffer, command string, admin bool) {
+	if len(server.adminKey) > 0 && !admin {
+		w.Write([]byte("403 Forbidden"))
+		return
+	}
+	method, rest, _ := strings.Cut(command, " ")
+	path, body, _ := strings.Cut(rest, " ")
+	result, err := server.db.updateMetadata(server.config.DataFolder, method, path, []byte(body))
+	if err != nil {
+		logError(err.Error())
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Write(result)
+}
@@ -0,0 +1,92 @@
+package core
+
+import (
+	"bytes"
+	"os"
+	"smartHome/src/core/entities"
+	"strings"
+	"testing"
+)
+
+func TestAdminCommands(t *testing.T) {
+	folder := t.TempDir()
+	err := os.WriteFile(folder+"/locations.json", []byte(`[{"Id": 1, "Name": "loc1", "LocationType": "int"}]`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(folder+"/sensors.json",
+		[]byte(`[{"Id": 1, "Name": "s1", "DataType": "env", "LocationId": 1, "DeviceId": 1, "DeviceSensors": {"0": "temp"}}]`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := DB{}
+	_, err = db.reloadMetadata(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	update := func(command string, expectedError string) string {
+		method, rest, _ := strings.Cut(command, " ")
+		path, body, _ := strings.Cut(rest, " ")
+		result, err := db.updateMetadata(folder, method, path, []byte(body))
+		if len(expectedError) > 0 {
+			if err == nil || !strings.HasPrefix(err.Error(), expectedError) {
+				t.Fatalf("%v: %v error expected, got %v", command, expectedError, err)
+			}
+			return ""
+		}
+		if err != nil {
+			t.Fatalf("%v: %v", command, err)
+		}
+		return string(result)
+	}
+
+	result := update(`POST /locations {"Name": "loc2", "LocationType": "ext"}`, "")
+	if !strings.Contains(result, `"Id":2`) {
+		t.Fatalf("wrong result: %v", result)
+	}
+	update(`POST /sensors {"Name": "s2", "DataType": "env", "LocationId": 2, "DeviceId": 1, "DeviceSensors": {"0": "temp"}}`,
+		"400")
+	update(`POST /sensors {"Name": "s2", "DataType": "env", "LocationId": 3, "DeviceId": 1}`, "400")
+	update(`POST /sensors {"Id": 1, "Name": "s2", "DataType": "env", "LocationId": 2}`, "400")
+	update(`POST /sensors/2 {"Name": "s2", "DataType": "env", "LocationId": 2}`, "400")
+	update(`POST /sensors {"Name": "s2", "DataType": "env", "LocationId": 2, "Calibration": {"temp": {"Unit": "x"}}}`, "400")
+	update(`POST /sensors {"Name": "s2", "DataType": "env", "LocationId": 2, "Offsets": {"": 1}}`, "400")
+	update(`POST /sensors {"Name": "s2", "DataType": "env", "LocationId": 2, "DeviceId": 1, "DeviceSensors": {"1": "temp"}}`,
+		"")
+	update(`PUT /sensors/2 {"Id": 3, "Name": "s2", "DataType": "env", "LocationId": 2}`, "400")
+	update(`PUT /sensors/3 {"Name": "s3", "DataType": "env", "LocationId": 2}`, "404")
+	update(`PUT /sensors/2 {"Name": "s2", "DataType": "ele", "LocationId": 2, "DeviceId": 2, "DeviceSensors": {"0": "pwr"}}`, "")
+	update(`DELETE /locations/2`, "400")
+	update(`DELETE /locations`, "400")
+	update(`GET /sensors/2`, "400")
+	update(`PUT /devices/2 {}`, "404")
+
+	if len(db.DataTypeMap["ele"]) != 1 || len(db.DeviceToSensors[2]) != 1 || db.Locations[2].Name != "loc2" {
+		t.Fatal("DB is not updated")
+	}
+	sensors, err := entities.ReadSensorsFromJson(folder + "/sensors.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sensors) != 2 || sensors[2].DataType != "ele" || sensors[2].DeviceSensors[0] != "pwr" {
+		t.Fatalf("wrong sensors file: %v", sensors)
+	}
+
+	update(`DELETE /sensors/2`, "")
+	update(`DELETE /locations/2`, "")
+	locations, err := entities.ReadLocationsFromJson(folder + "/locations.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locations) != 1 || len(db.Sensors) != 1 || len(db.Locations) != 1 {
+		t.Fatal("sensor and location should be deleted")
+	}
+
+	var w bytes.Buffer
+	AdminHandler(&Server{adminKey: []byte{1}, db: &db, config: &configuration{DataFolder: folder}}, &w,
+		`POST /locations {"Name": "loc3"}`, false)
+	if w.String() != "403 Forbidden" || len(db.Locations) != 1 {
+		t.Fatalf("admin command should be rejected: %v", w.String())
+	}
+}
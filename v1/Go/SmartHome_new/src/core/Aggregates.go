@@ -0,0 +1,79 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"smartHome/src/core/entities"
+	"strconv"
+)
+
+// Daily aggregates of past days are stored in <DataFolder>/aggregated/<date>.col files
+// in the rollup file format, so Load doesn't parse raw data of days having aggregates and rollups.
+
+func aggregatedFolderName(dataFolder string) string {
+	return dataFolder + string(os.PathSeparator) + "aggregated"
+}
+
+func aggregatedFileName(folder string, date int) string {
+	return folder + string(os.PathSeparator) + strconv.Itoa(date) + ".col"
+}
+
+// returns map date -> daily aggregates from aggregate files, missing folder is not an error
+func readAggregatedFiles(folder string) (map[int]map[int]entities.SensorData, error) {
+	data, err := readRollupFiles(folder)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[int]map[int]entities.SensorData)
+	for date, sensors := range data {
+		m := make(map[int]entities.SensorData)
+		for sensorId, dataArray := range sensors {
+			if len(dataArray) == 1 {
+				m[sensorId] = dataArray[0]
+			}
+		}
+		result[date] = m
+	}
+	return result, nil
+}
+
+func (a *DB) saveAggregated(date int, data map[int]entities.SensorData) {
+	if len(a.aggregatedFolder) == 0 {
+		return
+	}
+	m := make(map[int][]entities.SensorData)
+	for sensorId, d := range data {
+		m[sensorId] = []entities.SensorData{d}
+	}
+	err := writeRollupFile(a.aggregatedFolder, aggregatedFileName(a.aggregatedFolder, date), m)
+	if err != nil {
+		fmt.Printf("Aggregate file write error for %v: %v\n", date, err.Error())
+	}
+}
+
+func (a *DB) buildAggregated(date int, data map[int][]entities.SensorData, totalCalculation map[string]int) {
+	aggregated := aggregateSensorDataArray(data, totalCalculation)
+	a.SensorDataAggregated[date] = aggregated
+	a.saveAggregated(date, aggregated)
+}
+
+// rebuilds daily aggregates and rollups of the sensors from raw data and stores them
+func (a *DB) updateSensorStats(date int, sensorIds []int, totalCalculation map[string]int) {
+	aggregated, ok := a.SensorDataAggregated[date]
+	if !ok {
+		aggregated = make(map[int]entities.SensorData)
+		a.SensorDataAggregated[date] = aggregated
+	}
+	rollup, ok := a.SensorDataRollup[date]
+	if !ok {
+		rollup = make(map[int][]entities.SensorData)
+		a.SensorDataRollup[date] = rollup
+	}
+	for _, sensorId := range sensorIds {
+		data := map[int][]entities.SensorData{sensorId: a.SensorDataMap[date][sensorId]}
+		aggregated[sensorId] = aggregateSensorDataArray(data, totalCalculation)[sensorId]
+		rollup[sensorId] = rollupSensorDataArray(data, a.rollupMinutes, totalCalculation)[sensorId]
+	}
+	a.saveAggregated(date, aggregated)
+	a.saveRollup(date, rollup)
+}
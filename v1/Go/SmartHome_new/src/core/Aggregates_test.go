@@ -0,0 +1,61 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func copyTestFile(t *testing.T, from string, to string) {
+	dat, err := os.ReadFile(from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.MkdirAll(filepath.Dir(to), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(to, dat, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStoredAggregates(t *testing.T) {
+	folder := t.TempDir()
+	source := "../../test_resources/db"
+	for _, name := range []string{"locations.json", "sensors.json", "dates_new/20210107/1.json"} {
+		copyTestFile(t, filepath.Join(source, name), filepath.Join(folder, name))
+	}
+	config := configuration{DataFolder: folder, RawDataDays: 1}
+	now := time.Date(2021, 2, 6, 0, 0, 0, 0, time.UTC)
+	var db DB
+	err := db.Load(&config, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.openRollupStorage(folder)
+	expected := db.SensorDataAggregated[20210107][1]
+	if len(expected.Data.Stats) == 0 {
+		t.Fatal("aggregated data expected")
+	}
+
+	// days having stored aggregates and rollups must not be parsed
+	err = os.WriteFile(filepath.Join(folder, "dates_new/20210107/1.json"), []byte("invalid"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var db2 DB
+	err = db2.Load(&config, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(db2.SensorDataAggregated[20210107][1], expected) {
+		t.Fatalf("wrong stored aggregates: %v", db2.SensorDataAggregated[20210107][1])
+	}
+	if len(db2.SensorDataRollup[20210107][1]) == 0 {
+		t.Fatal("stored rollup expected")
+	}
+}
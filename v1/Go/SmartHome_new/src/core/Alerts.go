@@ -0,0 +1,376 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"smartHome/src/core/entities"
+	"strings"
+	"sync"
+	"time"
+)
+
+type alertNotifierConfig struct {
+	// exec, http or display
+	Type string
+	// exec: command and arguments, {message} is replaced with alert message
+	Command []string
+	// http: alert event is posted as json, display: /show url
+	Url string
+	// display: device name and text color
+	DeviceName string
+	Color      int16
+}
+
+type alertRule struct {
+	Name string
+	// rule is applied to the sensor, or to all sensors with the data type
+	SensorId int
+	DataType string
+	Property string
+	// value (default) or rate (change per hour)
+	Type string
+	// < or >
+	Comparison string
+	Threshold  float64
+	// seconds the condition should hold before alert is raised
+	Duration int
+	// alert is cleared when value is back beyond threshold by hysteresis
+	Hysteresis float64
+	Notifiers  []string
+}
+
+type alertConfiguration struct {
+	Notifiers map[string]alertNotifierConfig
+	Rules     []alertRule
+	// notifiers for sensors that stopped reporting
+	StaleSensorNotifiers []string
+}
+
+type alertEvent struct {
+	Rule      string
+	SensorId  int
+	Sensor    string
+	Location  string
+	Property  string
+	Value     float64
+	Active    bool
+	EventTime time.Time
+	Message   string
+}
+
+type alertNotifier interface {
+	notify(event alertEvent) error
+}
+
+type alertState struct {
+	conditionSince time.Time
+	active         bool
+	lastValue      float64
+	lastTime       time.Time
+	lastEvent      *alertEvent
+}
+
+type alertStateKey struct {
+	rule     int
+	sensorId int
+}
+
+type alertEngine struct {
+	db             *DB
+	rules          []alertRule
+	staleNotifiers []string
+	notifiers      map[string]alertNotifier
+	states         map[alertStateKey]*alertState
+	mutex          sync.Mutex
+}
+
+func loadAlertConfiguration(fileName string) (*alertConfiguration, error) {
+	dat, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	var config alertConfiguration
+	err = json.Unmarshal(dat, &config)
+	if err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+func buildAlertNotifier(name string, config alertNotifierConfig) (alertNotifier, error) {
+	switch config.Type {
+	case "exec":
+		if len(config.Command) == 0 {
+			return nil, fmt.Errorf("notifier %v: empty command", name)
+		}
+		return &execNotifier{command: config.Command}, nil
+	case "http":
+		if len(config.Url) == 0 {
+			return nil, fmt.Errorf("notifier %v: empty url", name)
+		}
+		return &httpNotifier{url: config.Url}, nil
+	case "display":
+		if len(config.Url) == 0 || len(config.DeviceName) == 0 {
+			return nil, fmt.Errorf("notifier %v: empty url or device name", name)
+		}
+		return &displayNotifier{url: config.Url, deviceName: config.DeviceName, color: config.Color}, nil
+	default:
+		return nil, fmt.Errorf("notifier %v: unknown type %v", name, config.Type)
+	}
+}
+
+func newAlertEngine(config *alertConfiguration, db *DB) (*alertEngine, error) {
+	engine := alertEngine{
+		db:             db,
+		rules:          config.Rules,
+		staleNotifiers: config.StaleSensorNotifiers,
+		notifiers:      make(map[string]alertNotifier),
+		states:         make(map[alertStateKey]*alertState),
+	}
+	for name, notifierConfig := range config.Notifiers {
+		notifier, err := buildAlertNotifier(name, notifierConfig)
+		if err != nil {
+			return nil, err
+		}
+		engine.notifiers[name] = notifier
+	}
+	for i, rule := range engine.rules {
+		if len(rule.Property) == 0 || (rule.SensorId == 0 && len(rule.DataType) == 0) {
+			return nil, fmt.Errorf("rule %v: property and sensor id or data type are required", rule.Name)
+		}
+		if rule.Comparison != "<" && rule.Comparison != ">" {
+			return nil, fmt.Errorf("rule %v: invalid comparison %v", rule.Name, rule.Comparison)
+		}
+		if rule.Type == "" {
+			engine.rules[i].Type = "value"
+		} else if rule.Type != "value" && rule.Type != "rate" {
+			return nil, fmt.Errorf("rule %v: invalid type %v", rule.Name, rule.Type)
+		}
+		if rule.Duration < 0 || rule.Hysteresis < 0 {
+			return nil, fmt.Errorf("rule %v: invalid duration or hysteresis", rule.Name)
+		}
+		for _, n := range rule.Notifiers {
+			_, ok := engine.notifiers[n]
+			if !ok {
+				return nil, fmt.Errorf("rule %v: unknown notifier %v", rule.Name, n)
+			}
+		}
+	}
+	for _, n := range engine.staleNotifiers {
+		_, ok := engine.notifiers[n]
+		if !ok {
+			return nil, fmt.Errorf("unknown stale sensor notifier %v", n)
+		}
+	}
+	return &engine, nil
+}
+
+func (r *alertRule) matches(sensorId int, sensor entities.Sensor) bool {
+	if r.SensorId != 0 {
+		return r.SensorId == sensorId
+	}
+	return r.DataType == sensor.DataType
+}
+
+func (r *alertRule) conditionMet(value float64) bool {
+	if r.Comparison == "<" {
+		return value < r.Threshold
+	}
+	return value > r.Threshold
+}
+
+func (r *alertRule) conditionCleared(value float64) bool {
+	if r.Comparison == "<" {
+		return value >= r.Threshold+r.Hysteresis
+	}
+	return value <= r.Threshold-r.Hysteresis
+}
+
+// DB listener
+func (e *alertEngine) process(sensorId int, date int, data entities.SensorData) {
+	sensors, locations := e.db.getMetadata()
+	sensor := sensors[sensorId]
+	t := eventTime(date, data.EventTime)
+	var events []alertEvent
+	var eventNotifiers [][]string
+	e.mutex.Lock()
+	for i := range e.rules {
+		rule := &e.rules[i]
+		if !rule.matches(sensorId, sensor) {
+			continue
+		}
+		v, ok := data.Data.Values[rule.Property]
+		if !ok {
+			continue
+		}
+		event := e.evaluate(i, rule, sensorId, float64(v)/100, t)
+		if event != nil {
+			event.SensorId = sensorId
+			event.Sensor = sensor.Name
+			event.Location = locations[sensor.LocationId].Name
+			event.Message = buildAlertMessage(event)
+			events = append(events, *event)
+			eventNotifiers = append(eventNotifiers, rule.Notifiers)
+		}
+	}
+	e.mutex.Unlock()
+	for i, event := range events {
+		log.Println(event.Message)
+		e.notify(eventNotifiers[i], event)
+	}
+}
+
+func (e *alertEngine) notify(notifiers []string, event alertEvent) {
+	for _, name := range notifiers {
+		go func(notifier alertNotifier, event alertEvent) {
+			err := notifier.notify(event)
+			if err != nil {
+				log.Printf("Alert notification error: %v\n", err.Error())
+			}
+		}(e.notifiers[name], event)
+	}
+}
+
+// returns an event when alert state changes
+func (e *alertEngine) evaluate(ruleNo int, rule *alertRule, sensorId int, value float64, t time.Time) *alertEvent {
+	key := alertStateKey{rule: ruleNo, sensorId: sensorId}
+	state, ok := e.states[key]
+	if !ok {
+		state = &alertState{}
+		e.states[key] = state
+	}
+	checked := value
+	if rule.Type == "rate" {
+		if state.lastTime.IsZero() || !t.After(state.lastTime) {
+			state.lastValue = value
+			state.lastTime = t
+			return nil
+		}
+		checked = (value - state.lastValue) / t.Sub(state.lastTime).Hours()
+		state.lastValue = value
+		state.lastTime = t
+	}
+	if state.active {
+		if rule.conditionCleared(checked) {
+			state.active = false
+			state.conditionSince = time.Time{}
+			state.lastEvent = nil
+			return &alertEvent{Rule: rule.Name, Property: rule.Property, Value: checked, Active: false, EventTime: t}
+		}
+		return nil
+	}
+	if !rule.conditionMet(checked) {
+		state.conditionSince = time.Time{}
+		return nil
+	}
+	if state.conditionSince.IsZero() {
+		state.conditionSince = t
+	}
+	if t.Sub(state.conditionSince) < time.Duration(rule.Duration)*time.Second {
+		return nil
+	}
+	state.active = true
+	event := &alertEvent{Rule: rule.Name, Property: rule.Property, Value: checked, Active: true, EventTime: t}
+	state.lastEvent = event
+	return event
+}
+
+func buildAlertMessage(event *alertEvent) string {
+	status := "cleared"
+	if event.Active {
+		status = "ALERT"
+	}
+	return fmt.Sprintf("%v %v: %v %v %v = %.2f", status, event.Rule, event.Location, event.Sensor, event.Property,
+		event.Value)
+}
+
+// returns active alerts
+func (e *alertEngine) activeAlerts() []alertEvent {
+	result := []alertEvent{}
+	e.mutex.Lock()
+	for _, state := range e.states {
+		if state.active && state.lastEvent != nil {
+			result = append(result, *state.lastEvent)
+		}
+	}
+	e.mutex.Unlock()
+	return result
+}
+
+func AlertsHandler(server *Server, w *bytes.Buffer) {
+	if server.alerts == nil {
+		w.Write([]byte("[]"))
+		return
+	}
+	data, err := json.Marshal(server.alerts.activeAlerts())
+	if err != nil {
+		w.Write([]byte(fmt.Sprintf("500 json.Marshal error: %v", err)))
+		return
+	}
+	w.Write(data)
+}
+
+type execNotifier struct {
+	command []string
+}
+
+func (n *execNotifier) notify(event alertEvent) error {
+	var args []string
+	for _, arg := range n.command[1:] {
+		args = append(args, strings.ReplaceAll(arg, "{message}", event.Message))
+	}
+	return exec.Command(n.command[0], args...).Run()
+}
+
+type httpNotifier struct {
+	url string
+}
+
+func postJson(url string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	client := http.Client{Timeout: 10 * time.Second}
+	response, err := client.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	_ = response.Body.Close()
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("%v: http status %v", url, response.StatusCode)
+	}
+	return nil
+}
+
+func (n *httpNotifier) notify(event alertEvent) error {
+	return postJson(n.url, event)
+}
+
+type displayTextLine struct {
+	Color int16
+	Text  string
+}
+
+type displayShowCommand struct {
+	DeviceName string
+	Messages   []displayTextLine
+}
+
+type displayNotifier struct {
+	url        string
+	deviceName string
+	color      int16
+}
+
+func (n *displayNotifier) notify(event alertEvent) error {
+	return postJson(n.url, displayShowCommand{
+		DeviceName: n.deviceName,
+		Messages:   []displayTextLine{{Color: n.color, Text: event.Message}},
+	})
+}
@@ -0,0 +1,108 @@
+package core
+
+import (
+	"smartHome/src/core/entities"
+	"testing"
+	"time"
+)
+
+type testNotifier struct {
+	events chan alertEvent
+}
+
+func (n *testNotifier) notify(event alertEvent) error {
+	n.events <- event
+	return nil
+}
+
+func buildTestAlertEngine(t *testing.T) (*alertEngine, *testNotifier) {
+	config, err := loadAlertConfiguration("../../test_resources/testAlerts.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := DB{
+		Sensors: map[int]entities.Sensor{
+			1: {Id: 1, Name: "cabinet_ext", DataType: "env", LocationId: 1},
+			5: {Id: 5, Name: "pump", DataType: "wat", LocationId: 1},
+		},
+		Locations: map[int]entities.Location{1: {Id: 1, Name: "loc1"}},
+	}
+	engine, err := newAlertEngine(config, &db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notifier := &testNotifier{events: make(chan alertEvent, 10)}
+	engine.notifiers["log"] = notifier
+	engine.notifiers["display"] = &testNotifier{events: make(chan alertEvent, 10)}
+	return engine, notifier
+}
+
+func processTestValue(engine *alertEngine, sensorId int, eventTime int, property string, value int) {
+	engine.process(sensorId, 20210107, entities.SensorData{
+		EventTime: eventTime,
+		Data:      entities.PropertyMap{Values: map[string]int{property: value}},
+	})
+}
+
+func expectAlertEvent(t *testing.T, notifier *testNotifier, active bool) {
+	select {
+	case event := <-notifier.events:
+		if event.Active != active {
+			t.Fatalf("wrong alert event: %v", event.Message)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("alert event expected")
+	}
+}
+
+func expectNoAlertEvent(t *testing.T, notifier *testNotifier) {
+	select {
+	case event := <-notifier.events:
+		t.Fatalf("unexpected alert event: %v", event.Message)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestThresholdAlert(t *testing.T) {
+	engine, notifier := buildTestAlertEngine(t)
+	processTestValue(engine, 1, 100000, "temp", 150)
+	processTestValue(engine, 1, 100500, "temp", 140)
+	expectNoAlertEvent(t, notifier)
+	processTestValue(engine, 1, 101000, "temp", 130)
+	expectAlertEvent(t, notifier, true)
+	if len(engine.activeAlerts()) != 1 {
+		t.Fatal("one active alert expected")
+	}
+	// within hysteresis
+	processTestValue(engine, 1, 101500, "temp", 220)
+	expectNoAlertEvent(t, notifier)
+	processTestValue(engine, 1, 102000, "temp", 260)
+	expectAlertEvent(t, notifier, false)
+	if len(engine.activeAlerts()) != 0 {
+		t.Fatal("no active alerts expected")
+	}
+}
+
+func TestRateAlert(t *testing.T) {
+	engine, notifier := buildTestAlertEngine(t)
+	processTestValue(engine, 5, 100000, "pres", 300)
+	processTestValue(engine, 5, 110000, "pres", 250)
+	expectNoAlertEvent(t, notifier)
+	processTestValue(engine, 5, 113000, "pres", 180)
+	expectAlertEvent(t, notifier, true)
+	processTestValue(engine, 5, 120000, "pres", 180)
+	expectAlertEvent(t, notifier, false)
+}
+
+func TestAlertConfigurationValidation(t *testing.T) {
+	_, err := newAlertEngine(&alertConfiguration{Rules: []alertRule{{Name: "r", DataType: "env", Property: "temp",
+		Comparison: "=", Threshold: 1}}}, &DB{})
+	if err == nil {
+		t.Fatal("invalid comparison should be rejected")
+	}
+	_, err = newAlertEngine(&alertConfiguration{Rules: []alertRule{{Name: "r", DataType: "env", Property: "temp",
+		Comparison: "<", Threshold: 1, Notifiers: []string{"unknown"}}}}, &DB{})
+	if err == nil {
+		t.Fatal("unknown notifier should be rejected")
+	}
+}
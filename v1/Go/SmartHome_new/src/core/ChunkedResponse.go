@@ -0,0 +1,170 @@
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Chunked response protocol.
+// Client sends "CHUNKED <command>", server compresses the response and splits it into chunks,
+// every chunk is encrypted separately and has a header:
+//   response id (uint32), chunk index (uint16), chunk count (uint16), compression type (byte)
+// Missing chunks are requested with "RESEND <response id> <index1>,<index2>,..."
+// while the response is kept in the server cache.
+
+const chunkHeaderSize = 9
+const chunkedResponseLifetime = 60 * time.Second
+
+const defaultChunkSize = 32000
+
+type chunkedResponse struct {
+	chunks  [][]byte
+	created time.Time
+}
+
+type chunkedResponseCache struct {
+	responses map[uint32]*chunkedResponse
+	lastId    uint32
+	mutex     sync.Mutex
+}
+
+func newChunkedResponseCache() *chunkedResponseCache {
+	return &chunkedResponseCache{responses: make(map[uint32]*chunkedResponse)}
+}
+
+// stores encrypted chunks, expired responses are removed
+func (c *chunkedResponseCache) add(id uint32, chunks [][]byte, now time.Time) {
+	c.mutex.Lock()
+	for k, r := range c.responses {
+		if now.Sub(r.created) > chunkedResponseLifetime {
+			delete(c.responses, k)
+		}
+	}
+	c.responses[id] = &chunkedResponse{chunks: chunks, created: now}
+	c.mutex.Unlock()
+}
+
+func (c *chunkedResponseCache) nextId() uint32 {
+	c.mutex.Lock()
+	c.lastId++
+	id := c.lastId
+	c.mutex.Unlock()
+	return id
+}
+
+func (c *chunkedResponseCache) get(id uint32, indexes []int) ([][]byte, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	r, ok := c.responses[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown or expired response id %v", id)
+	}
+	var result [][]byte
+	for _, idx := range indexes {
+		if idx < 0 || idx >= len(r.chunks) {
+			return nil, fmt.Errorf("invalid chunk index %v", idx)
+		}
+		result = append(result, r.chunks[idx])
+	}
+	return result, nil
+}
+
+// returns chunks with headers, not encrypted
+func buildChunks(id uint32, compressionType int, data []byte, chunkSize int) ([][]byte, error) {
+	count := (len(data) + chunkSize - 1) / chunkSize
+	if count == 0 {
+		count = 1
+	}
+	if count > 0xFFFF {
+		return nil, fmt.Errorf("response is too big: %v bytes", len(data))
+	}
+	var result [][]byte
+	for i := 0; i < count; i++ {
+		end := (i + 1) * chunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		chunk := make([]byte, chunkHeaderSize, chunkHeaderSize+end-i*chunkSize)
+		binary.LittleEndian.PutUint32(chunk, id)
+		binary.LittleEndian.PutUint16(chunk[4:], uint16(i))
+		binary.LittleEndian.PutUint16(chunk[6:], uint16(count))
+		chunk[8] = byte(compressionType)
+		result = append(result, append(chunk, data[i*chunkSize:end]...))
+	}
+	return result, nil
+}
+
+func encodeChunks(key []byte, compressionType int, id uint32, data []byte, chunkSize int) ([][]byte, error) {
+	compressed, err := compressData(compressionType, data)
+	if err != nil {
+		return nil, err
+	}
+	chunks, err := buildChunks(id, compressionType, compressed, chunkSize)
+	if err != nil {
+		return nil, err
+	}
+	for i, chunk := range chunks {
+		chunks[i], err = AesEncode(chunk, key, CompressNone, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return chunks, nil
+}
+
+func sendChunkedResponse(server *Server, addr net.Addr, data []byte) {
+	id := server.chunkedResponses.nextId()
+	chunks, err := encodeChunks(server.key, server.compressionType, id, data, server.chunkSize)
+	if err != nil {
+		logError(err.Error())
+		_, _ = server.conn.WriteTo([]byte(err.Error()), addr)
+		return
+	}
+	server.chunkedResponses.add(id, chunks, time.Now())
+	for _, chunk := range chunks {
+		_, _ = server.conn.WriteTo(chunk, addr)
+	}
+}
+
+// parses "<response id> <index1>,<index2>,..."
+func parseResendCommand(command string) (uint32, []int, error) {
+	parts := strings.Split(command, " ")
+	if len(parts) != 2 {
+		return 0, nil, fmt.Errorf("invalid RESEND command")
+	}
+	id, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid response id %v", parts[0])
+	}
+	var indexes []int
+	for _, s := range strings.Split(parts[1], ",") {
+		idx, err := strconv.Atoi(s)
+		if err != nil {
+			return 0, nil, fmt.Errorf("invalid chunk index %v", s)
+		}
+		indexes = append(indexes, idx)
+	}
+	return uint32(id), indexes, nil
+}
+
+func resendChunks(server *Server, addr net.Addr, command string) {
+	id, indexes, err := parseResendCommand(command)
+	if err == nil {
+		var chunks [][]byte
+		chunks, err = server.chunkedResponses.get(id, indexes)
+		if err == nil {
+			log.Printf("Resending %v chunks of response %v\n", len(chunks), id)
+			for _, chunk := range chunks {
+				_, _ = server.conn.WriteTo(chunk, addr)
+			}
+			return
+		}
+	}
+	logError(err.Error())
+}
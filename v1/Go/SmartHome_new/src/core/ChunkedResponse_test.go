@@ -0,0 +1,118 @@
+package core
+
+import (
+	"bytes"
+	"net"
+	"nonce"
+	"testing"
+	"time"
+)
+
+func startTestUdpServer(t *testing.T) *Server {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &Server{
+		key:              testKey,
+		conn:             conn,
+		compressionType:  CompressGzip,
+		config:           &configuration{},
+		chunkedResponses: newChunkedResponseCache(),
+		chunkSize:        defaultChunkSize,
+		nonces:           nonce.NewCache(0),
+	}
+}
+
+func TestChunkedResponse(t *testing.T) {
+	server := startTestUdpServer(t)
+	server.chunkSize = 16
+	go func() {
+		buffer := make([]byte, 10000)
+		n, addr, err := server.conn.ReadFrom(buffer)
+		if err == nil {
+			handle(server, addr, buffer[:n])
+		}
+	}()
+
+	data, err := udpSendChunked(testKey, server.conn.LocalAddr().String(), "GET /unknown", time.Second, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "Invalid GET operation" {
+		t.Fatalf("wrong response: %v", string(data))
+	}
+}
+
+func TestChunkedShortCommand(t *testing.T) {
+	server := startTestUdpServer(t)
+	go func() {
+		buffer := make([]byte, 10000)
+		n, addr, err := server.conn.ReadFrom(buffer)
+		if err == nil {
+			handle(server, addr, buffer[:n])
+		}
+	}()
+
+	data, err := udpSendChunked(testKey, server.conn.LocalAddr().String(), "X", time.Second, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "Invalid method string: X" {
+		t.Fatalf("wrong response: %v", string(data))
+	}
+}
+
+func TestChunkedResponseResend(t *testing.T) {
+	payload := make([]byte, 1000)
+	for i := range payload {
+		payload[i] = byte(i * 7)
+	}
+
+	server := startTestUdpServer(t)
+	go func() {
+		buffer := make([]byte, 10000)
+		_, addr, err := server.conn.ReadFrom(buffer)
+		if err != nil {
+			return
+		}
+		chunks, err := encodeChunks(testKey, CompressGzip, 7, payload, 100)
+		if err != nil {
+			return
+		}
+		server.chunkedResponses.add(7, chunks, time.Now())
+		// chunk 1 is lost
+		for i, chunk := range chunks {
+			if i != 1 {
+				_, _ = server.conn.WriteTo(chunk, addr)
+			}
+		}
+		n, addr, err := server.conn.ReadFrom(buffer)
+		if err == nil {
+			handle(server, addr, buffer[:n])
+		}
+	}()
+
+	data, err := udpSendChunked(testKey, server.conn.LocalAddr().String(), "GET /anything", 200*time.Millisecond, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, payload) {
+		t.Fatal("wrong response")
+	}
+}
+
+func TestParseResendCommand(t *testing.T) {
+	id, indexes, err := parseResendCommand("12 1,5,7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 12 || len(indexes) != 3 || indexes[0] != 1 || indexes[1] != 5 || indexes[2] != 7 {
+		t.Fatalf("wrong parse result: %v %v", id, indexes)
+	}
+	_, _, err = parseResendCommand("12")
+	if err == nil {
+		t.Fatal("error expected")
+	}
+}
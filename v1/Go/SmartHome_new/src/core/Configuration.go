@@ -8,28 +8,77 @@ import (
 )
 
 type fetchConfiguration struct {
-    KeyFileName     string
-    Interval        int
-    Timeout         int
-    Retries         int
-    Addresses       []string
-    timeoutDuration time.Duration
+    KeyFileName        string
+    // minutes
+    Interval           int
+    // seconds
+    Timeout            int
+    // consecutive failures before the address is reported as down, 3 by default
+    Retries            int
+    // delays after failures in seconds
+    BackoffMin         int
+    BackoffMax         int
+    // broker MaxResponseSize, next page is requested while a response contains PageSize messages or more
+    PageSize           int
+    // page requests limit per fetch cycle
+    MaxPages           int
+    Addresses          []string
+    timeoutDuration    time.Duration
+    intervalDuration   time.Duration
+    backoffMinDuration time.Duration
+    backoffMaxDuration time.Duration
 }
 
+const defaultRetries = 3
+const defaultBackoffMin = 5
+const defaultBackoffMax = 1800
+const defaultPageSize = 100
+const defaultMaxPages = 10
+const defaultMetricsAddress = "127.0.0.1"
+
 type configuration struct {
     DataFolder         string
     ZipFileName        string
     KeyFileName        string
     PortNumber         int
     TcpPortNumber      int
+    HttpPortNumber     int
+    // optional Prometheus metrics HTTP port
+    MetricsPortNumber  int
+    // metrics server bind address, 127.0.0.1 by default, metrics endpoint has no authorization
+    MetricsAddress     string
     CompressionType    string
     BackupInterval     int
     AggregationHour    int
     RawDataDays        int
+    RawDataCacheDays   int
     FetchConfiguration fetchConfiguration
+    // optional MQTT bridge
+    Mqtt               mqttConfiguration
     DeviceKeyFileName  string
+    // optional key for admin commands, when set admin commands encrypted with the server key are rejected
+    AdminKeyFileName   string
+    // deprecated, configuration having TimeOffset without TimeZone is rejected
     TimeOffset         int
+    // IANA time zone name used for day partitions and event times, server local time zone by default
+    TimeZone           string
+    location           *time.Location
+    // property -> divider for sum totals
     TotalCalculation   map[string]int
+    // property -> total calculation method: sum (default), counter or power
+    TotalMethods       map[string]string
+    // tariff time windows for totals
+    Tariffs            []tariff
+    // nonce acceptance window in seconds
+    NonceWindow        int
+    // optional alert rules file
+    AlertsFileName     string
+    // rollup interval in minutes
+    RollupMinutes      int
+    // queries for longer periods (in hours) use rollup data
+    RollupMinPeriod    int
+    // map data type -> retention policy, "default" is used for other data types
+    Retention          map[string]retentionPolicy
 }
 
 func loadConfiguration(iniFileName string) (*configuration, error) {
@@ -57,13 +106,70 @@ func loadConfiguration(iniFileName string) (*configuration, error) {
         }
         config.FetchConfiguration.Interval *= 60
         config.FetchConfiguration.timeoutDuration = time.Duration(config.FetchConfiguration.Timeout) * time.Second
+        config.FetchConfiguration.intervalDuration = time.Duration(config.FetchConfiguration.Interval) * time.Second
+        if config.FetchConfiguration.Retries <= 0 {
+            config.FetchConfiguration.Retries = defaultRetries
+        }
+        if config.FetchConfiguration.BackoffMin <= 0 {
+            config.FetchConfiguration.BackoffMin = defaultBackoffMin
+        }
+        if config.FetchConfiguration.BackoffMax < config.FetchConfiguration.BackoffMin {
+            config.FetchConfiguration.BackoffMax = defaultBackoffMax
+        }
+        if config.FetchConfiguration.PageSize <= 0 {
+            config.FetchConfiguration.PageSize = defaultPageSize
+        }
+        if config.FetchConfiguration.MaxPages <= 0 {
+            config.FetchConfiguration.MaxPages = defaultMaxPages
+        }
+        config.FetchConfiguration.backoffMinDuration = time.Duration(config.FetchConfiguration.BackoffMin) * time.Second
+        config.FetchConfiguration.backoffMaxDuration = time.Duration(config.FetchConfiguration.BackoffMax) * time.Second
     }
 
     config.BackupInterval *= 60
 
+    if config.RawDataCacheDays <= 0 {
+        config.RawDataCacheDays = 10
+    }
+
+    if len(config.MetricsAddress) == 0 {
+        config.MetricsAddress = defaultMetricsAddress
+    }
+
+    config.location, err = loadTimeZone(config.TimeZone, config.TimeOffset)
+    if err != nil {
+        return nil, err
+    }
+
+    if config.RollupMinutes <= 0 {
+        config.RollupMinutes = defaultRollupMinutes
+    } else if 1440%config.RollupMinutes != 0 {
+        return nil, fmt.Errorf("incorrect rollup interval")
+    }
+
+    err = validateTotalsConfiguration(config.TotalMethods, config.Tariffs)
+    if err != nil {
+        return nil, err
+    }
+
+    err = validateMqttConfiguration(&config.Mqtt)
+    if err != nil {
+        return nil, err
+    }
+
+    if config.RollupMinPeriod <= 0 {
+        config.RollupMinPeriod = defaultRollupMinPeriod
+    }
+
     if config.ZipFileName != "" {
         config.ZipFileName = config.DataFolder + string(os.PathSeparator) + config.ZipFileName
     }
 
+    for dataType, policy := range config.Retention {
+        if policy.Raw > 0 && config.ZipFileName == "" {
+            return nil, fmt.Errorf("raw data retention for %v requires zip file name", dataType)
+        }
+    }
+
     return &config, nil
 }
@@ -43,5 +43,8 @@ func TestConfigurationLoad(t *testing.T) {
 	if len(config.FetchConfiguration.Addresses) != 3 {
 		t.Fatal("incorrect FetchConfiguration.Addresses length")
 	}
+	if config.MetricsAddress != "127.0.0.1" {
+		t.Fatal("incorrect MetricsAddress default value")
+	}
 }
 
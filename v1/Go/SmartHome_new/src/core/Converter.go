@@ -0,0 +1,91 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"smartHome/src/core/entities"
+	"smartHome/src/core/files"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// converts all past days from dates_new folders and zip file to column files,
+// converted dates_new folders are removed, zip file is left untouched
+func Convert(iniFileName string) error {
+	config, err := loadConfiguration(iniFileName)
+	if err != nil {
+		return err
+	}
+	setTimeZone(config.location)
+	storage, err := files.NewFileStorage(config.DataFolder, config.ZipFileName)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	var dates []int
+	for date := range storage.Files {
+		dates = append(dates, date)
+	}
+	sort.Ints(dates)
+
+	today := toDate(time.Now())
+	for _, date := range dates {
+		if date >= today {
+			continue
+		}
+		err = convertDate(config.DataFolder, date, storage.Files[date])
+		if err != nil {
+			return fmt.Errorf("%v: %v", date, err.Error())
+		}
+	}
+	return nil
+}
+
+func convertDate(dataFolder string, date int, providers []files.FileProvider) error {
+	sensorData, err := entities.ReadSensorDataFromJson(providers)
+	if err != nil {
+		return err
+	}
+	err = entities.WriteSensorDataToColumnFile(dataFolder, date, sensorData)
+	if err != nil {
+		return err
+	}
+	// verify written file before removing the source
+	fileName := dataFolder + string(os.PathSeparator) + "dates_col" + string(os.PathSeparator) + strconv.Itoa(date) + ".col"
+	dat, err := os.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+	written, err := entities.DecodeColumnData(dat)
+	if err != nil {
+		return err
+	}
+	rows := 0
+	for sensorId, v := range sensorData {
+		if !sameSensorData(written[sensorId], v) {
+			return fmt.Errorf("column file verification failure for sensor %v", sensorId)
+		}
+		rows += len(v)
+	}
+	fmt.Printf("%v: %v sensors, %v rows converted\n", date, len(sensorData), rows)
+	return os.RemoveAll(dataFolder + string(os.PathSeparator) + "dates_new" + string(os.PathSeparator) + strconv.Itoa(date))
+}
+
+func sameSensorData(written []entities.SensorData, source []entities.SensorData) bool {
+	if len(written) != len(source) {
+		return false
+	}
+	for i, row := range source {
+		w := written[i]
+		if w.EventTime != row.EventTime || w.Timestamp != row.Timestamp || len(w.Data.Values) != len(row.Data.Values) {
+			return false
+		}
+		if len(row.Data.Values) > 0 && !reflect.DeepEqual(w.Data.Values, row.Data.Values) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,29 @@
+package core
+
+import (
+	"smartHome/src/core/entities"
+	"testing"
+)
+
+func TestSameSensorData(t *testing.T) {
+	source := []entities.SensorData{
+		{EventTime: 100, Timestamp: 1610013600, Data: entities.PropertyMap{Values: map[string]int{"temp": 2050}}},
+		{EventTime: 200},
+	}
+	written := []entities.SensorData{
+		{EventTime: 100, Timestamp: 1610013600, Data: entities.PropertyMap{Values: map[string]int{"temp": 2050}}},
+		{EventTime: 200, Data: entities.PropertyMap{Values: map[string]int{}}},
+	}
+	if !sameSensorData(written, source) {
+		t.Fatal("same data expected")
+	}
+	written[0].Data.Values["temp"] = 2051
+	if sameSensorData(written, source) {
+		t.Fatal("value difference expected")
+	}
+	written[0].Data.Values["temp"] = 2050
+	written[0].Timestamp = 0
+	if sameSensorData(written, source) {
+		t.Fatal("timestamp difference expected")
+	}
+}
@@ -14,6 +14,8 @@ func Run(iniFileName string) error {
 		return err
 	}
 
+	setTimeZone(config.location)
+
 	fmt.Println("Reading DB files...")
 	start := time.Now()
 	db := DB{}
@@ -22,14 +24,23 @@ func Run(iniFileName string) error {
 		return err
 	}
 	fmt.Printf("%v elapsed.\n", time.Since(start))
+	db.openWriteAheadLog(config.DataFolder)
+	db.openRollupStorage(config.DataFolder)
+	db.applyRetention(config, start)
 
-	//handle CTRL C
+	//handle CTRL C, SIGHUP - sensors and locations reload
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
 	go func() {
-		<-c
-		fmt.Print("Interrupt signal. Sending timer stop event...")
-		TimerTaskStopChannel <- true
+		for s := range c {
+			if s == syscall.SIGHUP {
+				db.reload(config.DataFolder)
+				continue
+			}
+			fmt.Print("Interrupt signal. Sending timer stop event...")
+			TimerTaskStopChannel <- true
+			break
+		}
 	}()
 
 	var compressionType int
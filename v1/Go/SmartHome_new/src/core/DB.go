@@ -2,7 +2,6 @@ package core
 
 import (
 	"fmt"
-	"os"
 	"smartHome/src/core/entities"
 	"smartHome/src/core/files"
 	"sync"
@@ -16,36 +15,151 @@ type DB struct {
 	Sensors map[int]entities.Sensor
 	// map deviceId -> array of sensor ids
 	DeviceToSensors map[int][]int
+	// map sensorId -> array of virtual sensor ids using the sensor
+	virtualSensors map[int][]int
 	// map date -> [map sensorId -> []entities.SensorData]
 	SensorDataMap map[int]map[int][]entities.SensorData
 	// map date -> [map sensorId -> entities.SensorData]
 	SensorDataAggregated map[int]map[int]entities.SensorData
+	// map date -> [map sensorId -> rollup records]
+	SensorDataRollup map[int]map[int][]entities.SensorData
 	// map dataType -> array if sensor Ids
 	DataTypeMap map[string][]int
 	// map date -> list of sensor ids
 	DataToBeSaved map[int][]int
-	mutex         sync.RWMutex
+	// log of accepted sensor data, nil when disabled
+	wal *writeAheadLog
+	// index of days available in data folder and zip file
+	storage *files.FileStorage
+	// raw sensor data days loaded from storage on demand
+	rawDataCache *dayCache
+	// rollup interval in minutes
+	rollupMinutes    int
+	totalCalculation map[string]int
+	// folder for rollup files, empty when rollups are not stored
+	rollupFolder string
+	// folder for daily aggregate files, empty when aggregates are not stored
+	aggregatedFolder string
+	// called for every stored sensor data value
+	listeners []sensorDataListener
+	mutex     sync.RWMutex
+	// serializes sensors and locations updates
+	metadataMutex sync.Mutex
+}
+
+type sensorDataListener func(sensorId int, date int, data entities.SensorData)
+
+func (a *DB) addListener(listener sensorDataListener) {
+	a.listeners = append(a.listeners, listener)
 }
 
 func (a *DB) Load(config *configuration, now time.Time) error {
 	storage, err := files.NewFileStorage(config.DataFolder, config.ZipFileName)
-	defer storage.Close()
 	if err != nil {
 		return err
 	}
-	a.Locations, err = entities.ReadLocationsFromJson(config.DataFolder + string(os.PathSeparator) + "locations.json")
+	a.storage = storage
+	a.rawDataCache = newDayCache(config.RawDataCacheDays)
+	a.rollupMinutes = config.RollupMinutes
+	if a.rollupMinutes <= 0 {
+		a.rollupMinutes = defaultRollupMinutes
+	}
+	a.totalCalculation = config.TotalCalculation
+	a.Locations, err = readLocations(config.DataFolder)
 	if err != nil {
 		return err
 	}
-	a.Sensors, err = entities.ReadSensorsFromJson(config.DataFolder + string(os.PathSeparator) + "sensors.json")
+	a.Sensors, err = readSensors(config.DataFolder)
 	if err != nil {
 		return err
 	}
 	a.buildDataTypeMap()
 	a.buildDeviceToSensors()
+	a.buildVirtualSensorMap()
 	a.DataToBeSaved = make(map[int][]int)
 	a.mutex = sync.RWMutex{}
-	return a.ReadSensorDataFromJson(storage, now, config)
+	err = a.ReadSensorDataFromJson(storage, now, config)
+	if err != nil {
+		return err
+	}
+	return a.replayLog(config, now)
+}
+
+func (a *DB) replayLog(config *configuration, now time.Time) error {
+	dates, err := a.replayWriteAheadLog(config.DataFolder)
+	if err != nil {
+		return err
+	}
+	today := toDate(now)
+	for _, date := range dates {
+		d, ok := a.SensorDataMap[date]
+		if ok && date < today {
+			a.buildAggregated(date, d, config.TotalCalculation)
+			a.buildRollup(date, d, config.TotalCalculation)
+		}
+	}
+	return nil
+}
+
+func (a *DB) openWriteAheadLog(dataFolder string) {
+	a.wal = newWriteAheadLog(dataFolder)
+}
+
+func (a *DB) Close() {
+	if a.storage != nil {
+		a.storage.Close()
+	}
+	if a.wal != nil {
+		a.wal.Close()
+	}
+}
+
+// reads raw data of days from start to end missing in memory from the cache or file storage,
+// files are parsed without holding the DB lock, days having rollup data are skipped when skipRolledUp is set.
+// Returns map date -> raw data, the caller must not hold the DB lock.
+func (a *DB) readRawDays(start int, end int, skipRolledUp bool) map[int]map[int][]entities.SensorData {
+	result := make(map[int]map[int][]entities.SensorData)
+	providers := make(map[int][]files.FileProvider)
+	a.mutex.RLock()
+	if a.storage != nil {
+		for date := start; date <= end; date = nextDate(date) {
+			if _, ok := a.SensorDataMap[date]; ok {
+				continue
+			}
+			if _, ok := a.SensorDataRollup[date]; ok && skipRolledUp {
+				continue
+			}
+			data, ok := a.rawDataCache.get(date)
+			if ok {
+				result[date] = data
+				continue
+			}
+			p, ok := a.storage.Files[date]
+			if ok {
+				providers[date] = p
+			}
+		}
+	}
+	a.mutex.RUnlock()
+	for date, p := range providers {
+		data, err := entities.ReadSensorDataFromJson(p)
+		if err != nil {
+			fmt.Printf("Raw sensor data read error for %v: %v\n", date, err.Error())
+			continue
+		}
+		a.rawDataCache.put(date, data)
+		result[date] = data
+	}
+	return result
+}
+
+// returns raw sensor data for the date from memory or days returned by readRawDays, called under DB lock
+func (a *DB) rawDayData(date int, days map[int]map[int][]entities.SensorData) map[int][]entities.SensorData {
+	data, ok := a.SensorDataMap[date]
+	if ok {
+		return data
+	}
+	return days[date]
 }
 
 func (a *DB) buildDataTypeMap() {
@@ -60,34 +174,56 @@ func (a *DB) buildDataTypeMap() {
 	}
 }
 
+// loads raw data of last RawDataDays days, older days are parsed only when they have no stored aggregates or rollups
 func (a *DB) ReadSensorDataFromJson(storage *files.FileStorage, now time.Time, config *configuration) error {
 	a.SensorDataMap = make(map[int]map[int][]entities.SensorData)
-	a.SensorDataAggregated = make(map[int]map[int]entities.SensorData)
+	var err error
+	a.SensorDataAggregated, err = readAggregatedFiles(aggregatedFolderName(config.DataFolder))
+	if err != nil {
+		return err
+	}
+	a.SensorDataRollup, err = readRollupFiles(rollupFolderName(config.DataFolder, a.rollupMinutes))
+	if err != nil {
+		return err
+	}
+	today := toDate(now)
 	for date, files := range storage.Files {
+		days := dateAge(date, now)
+		_, aggregated := a.SensorDataAggregated[date]
+		_, rolledUp := a.SensorDataRollup[date]
+		if days > config.RawDataDays && aggregated && rolledUp {
+			continue
+		}
 		sensorData, err := entities.ReadSensorDataFromJson(files)
 		if err != nil {
 			return err
 		}
-		days := int(now.Sub(buildDate(date)).Hours() / 24)
 		if days <= config.RawDataDays {
 			a.SensorDataMap[date] = sensorData
 		}
-		a.SensorDataAggregated[date] = aggregateSensorDataArray(sensorData, config.TotalCalculation)
+		if !aggregated || date >= today {
+			a.SensorDataAggregated[date] = aggregateSensorDataArray(sensorData, config.TotalCalculation)
+		}
+		if !rolledUp && date < today {
+			a.SensorDataRollup[date] = rollupSensorDataArray(sensorData, a.rollupMinutes, config.TotalCalculation)
+		}
 	}
 	return nil
 }
 
 func (a *DB) aggregateLastDayData(totalCalculation map[string]int) {
 	lastDay := toDate(time.Now().AddDate(0, 0, -1))
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
 	d, ok := a.SensorDataMap[lastDay]
 	if ok {
-		a.mutex.RLock()
-		a.SensorDataAggregated[lastDay] = aggregateSensorDataArray(d, totalCalculation)
-		a.mutex.RUnlock()
+		a.buildAggregated(lastDay, d, totalCalculation)
+		a.buildRollup(lastDay, d, totalCalculation)
 	}
 }
 
 func (a *DB) backupData(config *configuration, now time.Time) {
+	today := toDate(now)
 	a.mutex.Lock()
 	for date, sensors := range a.DataToBeSaved {
 		var m []int
@@ -96,6 +232,10 @@ func (a *DB) backupData(config *configuration, now time.Time) {
 				m = append(m, sensorId)
 			}
 		}
+		// stored aggregates and rollups of past days must match saved raw data
+		if date < today {
+			a.updateSensorStats(date, sensors, config.TotalCalculation)
+		}
 		if len(m) == 0 {
 			delete(a.DataToBeSaved, date)
 		} else {
@@ -104,29 +244,41 @@ func (a *DB) backupData(config *configuration, now time.Time) {
 	}
 	a.deleteOldRawSensorData(config.RawDataDays, now)
 	a.mutex.Unlock()
+	if a.wal != nil {
+		a.wal.compact(a.hasUnsavedData)
+	}
+}
+
+func (a *DB) hasUnsavedData(date int) bool {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	_, ok := a.DataToBeSaved[date]
+	return ok
 }
 
 func (a *DB) deleteOldRawSensorData(rawDataDays int, now time.Time) {
 	for date := range a.SensorDataMap {
-		days := int(now.Sub(buildDate(date)).Hours() / 24)
+		days := dateAge(date, now)
 		//log.Printf("now = %v, date = %v, dats = %v\n", now, date, days)
 		if days > rawDataDays {
 			fmt.Printf("Deleting raw sensor data for %v...\n", date)
 			delete(a.SensorDataMap, date)
+			if a.storage != nil {
+				err := a.storage.UpdateDate(date)
+				if err != nil {
+					fmt.Printf("File storage update error for %v: %v\n", date, err.Error())
+				}
+				a.rawDataCache.remove(date)
+			}
 		}
 	}
 }
 
-func (a *DB) updateOffsets(sensorId int, propertyMap entities.PropertyMap) {
-	sensor, ok := a.Sensors[sensorId]
+func (a *DB) calibrate(sensorId int, propertyMap entities.PropertyMap) {
+	sensors, _ := a.getMetadata()
+	sensor, ok := sensors[sensorId]
 	if ok {
-		for dataType, offset := range sensor.Offsets {
-			var value int
-			value, ok = propertyMap.Values[dataType]
-			if ok {
-				propertyMap.Values[dataType] = value + offset
-			}
-		}
+		sensor.Calibrate(propertyMap)
 	}
 }
 
@@ -137,15 +289,38 @@ func (a *DB) saveSensorData(sensorId int, m decodedMessage) error {
 	}
 	d, t := toDateTime(m.MessageTime)
 
-	a.updateOffsets(sensorId, m.Message)
+	a.calibrate(sensorId, m.Message)
 
-	a.mutex.RLock()
-	if a.addToSensorData(m, d, t, sensorId) {
-		a.addToDataToBeSaved(d, sensorId)
+	var err error
+	data := entities.SensorData{EventTime: t, Data: m.Message, Timestamp: m.MessageTime.Unix()}
+	// sensor data is saved concurrently by UDP handlers, fetch workers and MQTT bridge
+	store := func() bool {
+		a.mutex.Lock()
+		defer a.mutex.Unlock()
+		added := a.storeSensorData(data, d, sensorId)
+		if added {
+			a.addToDataToBeSaved(d, sensorId)
+		}
+		return added
+	}
+	var added bool
+	if a.wal != nil {
+		// log file is synced without DB and log locks
+		added, err = a.wal.add(d, sensorId, data, store)
+	} else {
+		added = store()
 	}
-	a.mutex.RUnlock()
 
-	return nil
+	if added {
+		for _, listener := range a.listeners {
+			listener(sensorId, d, data)
+		}
+		if err == nil {
+			err = a.updateVirtualSensors(sensorId, m.MessageTime)
+		}
+	}
+
+	return err
 }
 
 func (a *DB) addToDataToBeSaved(date int, sensorId int) {
@@ -166,11 +341,7 @@ func (a *DB) addToDataToBeSaved(date int, sensorId int) {
 	}
 }
 
-func (a *DB) addToSensorData(m decodedMessage, date int, tim int, sensorId int) bool {
-	v := entities.SensorData{
-		EventTime: tim,
-		Data:      m.Message,
-	}
+func (a *DB) addToSensorData(v entities.SensorData, date int, sensorId int) bool {
 	d, ok := a.SensorDataMap[date]
 	if !ok {
 		d = make(map[int][]entities.SensorData)
@@ -182,7 +353,7 @@ func (a *DB) addToSensorData(m decodedMessage, date int, tim int, sensorId int)
 			d[sensorId] = []entities.SensorData{v}
 		} else {
 			for _, sdata := range sd {
-				if sdata.EventTime == tim {
+				if sdata.SameTime(&v) {
 					return false
 				}
 			}
@@ -194,8 +365,9 @@ func (a *DB) addToSensorData(m decodedMessage, date int, tim int, sensorId int)
 }
 
 func (a *DB) GetSensor(sensorIds []int, sensorId int) (int, string) {
+	sensors, _ := a.getMetadata()
 	for _, realSensorId := range sensorIds {
-		sensor, ok := a.Sensors[realSensorId]
+		sensor, ok := sensors[realSensorId]
 		if ok {
 			deviceSensor, ok := sensor.DeviceSensors[sensorId]
 			if ok {
@@ -209,23 +381,55 @@ func (a *DB) GetSensor(sensorIds []int, sensorId int) (int, string) {
 func (a *DB) buildDeviceToSensors() {
 	a.DeviceToSensors = make(map[int][]int)
 	for sensorId, sensor := range a.Sensors {
+		if sensor.IsVirtual() {
+			continue
+		}
 		a.DeviceToSensors[sensor.DeviceId] = append(a.DeviceToSensors[sensor.DeviceId], sensorId)
 	}
 }
 
+// time zone used for day partitions and event times
+var timeZone = time.Local
+
+// legacy TimeOffset is rejected because a fixed offset can't follow DST changes
+func loadTimeZone(name string, timeOffset int) (*time.Location, error) {
+	if len(name) > 0 {
+		return time.LoadLocation(name)
+	}
+	if timeOffset != 0 {
+		return nil, fmt.Errorf("TimeOffset is not supported, set TimeZone to the IANA time zone name")
+	}
+	return time.Local, nil
+}
+
+func setTimeZone(location *time.Location) {
+	if location != nil {
+		timeZone = location
+	}
+}
+
 func buildDate(date int) time.Time {
-	return time.Date(date/10000, time.Month((date/100)%100), date%100, 0, 0, 0, 0, time.UTC)
+	return time.Date(date/10000, time.Month((date/100)%100), date%100, 0, 0, 0, 0, timeZone)
+}
+
+// returns time for the date and HHMMSS event time
+func eventTime(date int, eventTime int) time.Time {
+	return time.Date(date/10000, time.Month((date/100)%100), date%100, eventTime/10000, (eventTime/100)%100,
+		eventTime%100, 0, timeZone)
 }
 
 func toDate(t time.Time) int {
+	t = t.In(timeZone)
 	return t.Year()*10000 + int(t.Month())*100 + t.Day()
 }
 
 func toDateTime(t time.Time) (int, int) {
+	t = t.In(timeZone)
 	return toDate(t), t.Hour()*10000 + t.Minute()*100 + t.Second()
 }
 
 func fromTime(t time.Time) int64 {
+	t = t.In(timeZone)
 	return int64(t.Year())*10000000000 + int64(t.Month())*100000000 + int64(t.Day())*1000000 + int64(t.Hour())*10000 +
 		int64(t.Minute())*100 + int64(t.Second())
 }
@@ -233,5 +437,5 @@ func fromTime(t time.Time) int64 {
 func nextDate(date1 int) int {
 	t := time.Date(date1/10000, time.Month((date1/100)%100), date1%100, 0, 0, 0, 0, time.UTC).
 		AddDate(0, 0, 1)
-	return toDate(t)
+	return t.Year()*10000 + int(t.Month())*100 + t.Day()
 }
@@ -23,7 +23,7 @@ func TestDBLoad(t *testing.T) {
 	testDataTypeMap(t, &db)
 	testSensorDataMap(t, &db)
 	testSensorDataAggregated(t, &db)
-	testUpdateOffsets(t, &db)
+	testCalibrate(t, &db)
 }
 
 func testSensorDataAggregated(t *testing.T, db *DB) {
@@ -182,11 +182,11 @@ func testDataTypeMap(t *testing.T, db *DB) {
 	}
 }
 
-func testUpdateOffsets(t *testing.T, db *DB) {
+func testCalibrate(t *testing.T, db *DB) {
 	m := entities.PropertyMap{
 		Values: map[string]int{"temp": 1100, "humi": 5000},
 	}
-	db.updateOffsets(1, m)
+	db.calibrate(1, m)
 	if m.Values["temp"] != 1100 {
 		t.Fatal("Wrong temp value")
 	}
@@ -198,11 +198,17 @@ func testUpdateOffsets(t *testing.T, db *DB) {
 		sensor.Offsets = map[string]int{"temp": -100}
 		db.Sensors[1] = sensor
 	}
-	db.updateOffsets(1, m)
+	db.calibrate(1, m)
 	if m.Values["temp"] != 1000 {
 		t.Fatal("Wrong corrected temp value")
 	}
 	if m.Values["humi"] != 5000 {
 		t.Fatal("Wrong temp value")
 	}
+	// values of sensors without calibration are not changed
+	m = entities.PropertyMap{Values: map[string]int{"pwr": 12}}
+	db.calibrate(5, m)
+	if m.Values["pwr"] != 12 {
+		t.Fatalf("Wrong pwr value: %v", m.Values["pwr"])
+	}
 }
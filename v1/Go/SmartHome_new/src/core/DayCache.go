@@ -0,0 +1,67 @@
+package core
+
+import (
+	"container/list"
+	"smartHome/src/core/entities"
+	"sync"
+)
+
+type dayCacheItem struct {
+	date int
+	data map[int][]entities.SensorData
+}
+
+// bounded LRU cache of raw sensor data days loaded from file storage,
+// has its own mutex because it is updated by readers holding DB.mutex read lock
+type dayCache struct {
+	capacity int
+	items    map[int]*list.Element
+	order    *list.List
+	mutex    sync.Mutex
+}
+
+func newDayCache(capacity int) *dayCache {
+	return &dayCache{
+		capacity: capacity,
+		items:    make(map[int]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func (c *dayCache) get(date int) (map[int][]entities.SensorData, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	e, ok := c.items[date]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*dayCacheItem).data, true
+}
+
+func (c *dayCache) put(date int, data map[int][]entities.SensorData) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	e, ok := c.items[date]
+	if ok {
+		e.Value.(*dayCacheItem).data = data
+		c.order.MoveToFront(e)
+		return
+	}
+	c.items[date] = c.order.PushFront(&dayCacheItem{date: date, data: data})
+	for c.order.Len() > c.capacity {
+		last := c.order.Back()
+		c.order.Remove(last)
+		delete(c.items, last.Value.(*dayCacheItem).date)
+	}
+}
+
+func (c *dayCache) remove(date int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	e, ok := c.items[date]
+	if ok {
+		c.order.Remove(e)
+		delete(c.items, date)
+	}
+}
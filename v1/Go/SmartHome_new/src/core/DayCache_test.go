@@ -0,0 +1,51 @@
+package core
+
+import (
+	"smartHome/src/core/entities"
+	"sync"
+	"testing"
+)
+
+func TestDayCacheEviction(t *testing.T) {
+	c := newDayCache(2)
+	c.put(1, map[int][]entities.SensorData{})
+	c.put(2, map[int][]entities.SensorData{})
+	if _, ok := c.get(1); !ok {
+		t.Fatal("date 1 should be cached")
+	}
+	c.put(3, map[int][]entities.SensorData{})
+	if _, ok := c.get(2); ok {
+		t.Fatal("date 2 should be evicted")
+	}
+	if _, ok := c.get(1); !ok {
+		t.Fatal("date 1 should be cached")
+	}
+	if _, ok := c.get(3); !ok {
+		t.Fatal("date 3 should be cached")
+	}
+	c.remove(3)
+	if _, ok := c.get(3); ok {
+		t.Fatal("date 3 should be removed")
+	}
+}
+
+// cache is used by readers holding DB read lock concurrently
+func TestDayCacheConcurrentAccess(t *testing.T) {
+	c := newDayCache(3)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for date := 0; date < 100; date++ {
+				if _, ok := c.get(date); !ok {
+					c.put(date, map[int][]entities.SensorData{i: nil})
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if c.order.Len() != 3 || len(c.items) != 3 {
+		t.Fatalf("wrong cache size: %v %v", c.order.Len(), len(c.items))
+	}
+}
@@ -0,0 +1,102 @@
+package core
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Device packet format version 2:
+//   header byte (2) | nonce (12 bytes) | AES-GCM encrypted data | GCM tag (16 bytes)
+// The header byte is authenticated as additional data, the device key is used as AES-GCM key.
+// Decrypted data (little endian):
+//   device id (2 bytes) | event time (4 bytes) | values
+// Every value is a TLV:
+//   device sensor index (1 byte) | type (1 byte) | value length (1 byte, 1-8) | value
+// Type high 4 bits - value kind: 0 - signed integer, 1 - unsigned integer, other kinds are skipped,
+// low 4 bits - scale: number of decimal digits, physical value = value / 10^scale.
+// Packets without valid GCM tag are decoded as old fixed size packets.
+
+const devicePacketVersion2 = 2
+const devicePacketNonceSize = 12
+const devicePacketTagSize = 16
+
+const (
+	deviceValueSigned   = 0
+	deviceValueUnsigned = 1
+)
+
+type devicePacket struct {
+	deviceId  int
+	eventTime uint32
+	// map device sensor index -> value multiplied by 100
+	values map[int]int
+}
+
+func isDevicePacketV2(data []byte) bool {
+	return len(data) >= 1+devicePacketNonceSize+6+devicePacketTagSize && data[0] == devicePacketVersion2
+}
+
+func decodeDevicePacketV2(key []byte, data []byte) (*devicePacket, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := gcm.Open(nil, data[1:1+devicePacketNonceSize], data[1+devicePacketNonceSize:], data[:1])
+	if err != nil {
+		return nil, err
+	}
+	packet := devicePacket{
+		deviceId:  int(binary.LittleEndian.Uint16(plain)),
+		eventTime: binary.LittleEndian.Uint32(plain[2:]),
+		values:    make(map[int]int),
+	}
+	rest := plain[6:]
+	for len(rest) > 0 {
+		if len(rest) < 3 || len(rest) < 3+int(rest[2]) {
+			return nil, fmt.Errorf("device %v: truncated packet value", packet.deviceId)
+		}
+		index, valueType, l := int(rest[0]), rest[1], int(rest[2])
+		value, ok := decodeDeviceValue(valueType, rest[3:3+l])
+		if ok {
+			packet.values[index] = value
+		}
+		rest = rest[3+l:]
+	}
+	return &packet, nil
+}
+
+// returns value multiplied by 100, false for unknown value type
+func decodeDeviceValue(valueType byte, data []byte) (int, bool) {
+	kind := valueType >> 4
+	scale := int(valueType & 0x0F)
+	l := len(data)
+	if l == 0 || l > 8 || scale > 9 || (kind != deviceValueSigned && kind != deviceValueUnsigned) {
+		return 0, false
+	}
+	var u uint64
+	for i := l - 1; i >= 0; i-- {
+		u = u<<8 | uint64(data[i])
+	}
+	var raw int64
+	if kind == deviceValueSigned {
+		// sign extension
+		shift := 64 - 8*l
+		raw = int64(u<<shift) >> shift
+	} else {
+		if u > math.MaxInt64 {
+			return 0, false
+		}
+		raw = int64(u)
+	}
+	if scale <= 2 {
+		return int(raw * int64(math.Pow10(2-scale))), true
+	}
+	return int(math.Round(float64(raw) / math.Pow10(scale-2))), true
+}
@@ -0,0 +1,130 @@
+package core
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"smartHome/src/core/entities"
+	"testing"
+	"time"
+)
+
+type testDeviceValue struct {
+	index     byte
+	valueType byte
+	value     []byte
+}
+
+func buildDevicePacketV2(t *testing.T, key []byte, deviceId int, eventTime uint32, values []testDeviceValue) []byte {
+	plain := binary.LittleEndian.AppendUint16(nil, uint16(deviceId))
+	plain = binary.LittleEndian.AppendUint32(plain, eventTime)
+	for _, v := range values {
+		plain = append(append(plain, v.index, v.valueType, byte(len(v.value))), v.value...)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce, err := GenerateRandomBytes(devicePacketNonceSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := []byte{devicePacketVersion2}
+	return gcm.Seal(append(header, nonce...), nonce, plain, header)
+}
+
+func TestDecodeDeviceValue(t *testing.T) {
+	tests := []struct {
+		valueType byte
+		data      []byte
+		expected  int
+		ok        bool
+	}{
+		{0x02, []byte{0x18, 0xFC}, -1000, true},
+		{0x01, []byte{0x83, 0xFF}, -1250, true},
+		{0x00, []byte{0xFF}, -100, true},
+		{0x10, []byte{0xFF}, 25500, true},
+		{0x10, []byte{0x00, 0x28, 0x6B, 0xEE}, 400000000000, true},
+		// 10.005
+		{0x03, []byte{0x15, 0x27}, 1001, true},
+		// 1.2343
+		{0x04, []byte{0x37, 0x30}, 123, true},
+		{0x00, []byte{0xFE, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}, -200, true},
+		{0x10, []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}, 0, false},
+		{0x20, []byte{1}, 0, false},
+		{0x0A, []byte{1}, 0, false},
+		{0x00, nil, 0, false},
+	}
+	for _, test := range tests {
+		value, ok := decodeDeviceValue(test.valueType, test.data)
+		if ok != test.ok || value != test.expected {
+			t.Errorf("%x %v: wrong value %v %v", test.valueType, test.data, value, ok)
+		}
+	}
+}
+
+func TestSensorDataLoadV2(t *testing.T) {
+	server := Server{
+		deviceKey: testKey,
+		db: &DB{
+			Sensors: map[int]entities.Sensor{
+				1: {Id: 1, DeviceId: 2, DeviceSensors: map[int]string{0: "temp", 12: "cnt"}},
+				2: {Id: 2, DeviceId: 2, DeviceSensors: map[int]string{1: "humi"}},
+			},
+			SensorDataMap:   make(map[int]map[int][]entities.SensorData),
+			DataToBeSaved:   make(map[int][]int),
+			DeviceToSensors: map[int][]int{2: {1, 2}},
+		},
+	}
+	eventTime := uint32(time.Date(2021, 1, 7, 10, 0, 0, 0, time.UTC).Unix())
+	packet := buildDevicePacketV2(t, testKey, 2, eventTime, []testDeviceValue{
+		// -12.5
+		{0, 0x01, []byte{0x83, 0xFF}},
+		// 45.67
+		{1, 0x02, []byte{0xD7, 0x11}},
+		// 32 bit counter 4000000000
+		{12, 0x10, []byte{0x00, 0x28, 0x6B, 0xEE}},
+		// unknown value type
+		{3, 0x70, []byte{1, 2, 3}},
+		// device sensor without mapping
+		{50, 0x00, []byte{1}},
+	})
+	if len(packet) == 16 || len(packet) == 32 || len(packet) == 48 {
+		t.Fatalf("test packet has old format size %v", len(packet))
+	}
+
+	lastDeviceTime[2] = 0
+	tampered := append([]byte(nil), packet...)
+	tampered[len(tampered)-20] ^= 1
+	if tryLoadSensorData(&server, tampered, true) {
+		t.Fatal("should fail to load tampered packet")
+	}
+	if !tryLoadSensorData(&server, packet, true) {
+		t.Fatal("failed to load sensor data")
+	}
+	if tryLoadSensorData(&server, packet, true) {
+		t.Fatal("should fail to load repeated packet")
+	}
+
+	data := server.db.SensorDataMap[toDate(time.Unix(int64(eventTime), 0))]
+	if len(data[1]) != 1 || len(data[2]) != 1 {
+		t.Fatalf("wrong stored data %v", data)
+	}
+	values := data[1][0].Data.Values
+	if len(values) != 2 || values["temp"] != -1250 || values["cnt"] != 400000000000 {
+		t.Fatalf("wrong sensor 1 values %v", values)
+	}
+	if data[2][0].Data.Values["humi"] != 4567 || data[2][0].Timestamp != int64(eventTime) {
+		t.Fatalf("wrong sensor 2 data %v", data[2][0])
+	}
+
+	// wrong key
+	packet = buildDevicePacketV2(t, make([]byte, 16), 2, eventTime+1, []testDeviceValue{{0, 0x00, []byte{1}}})
+	if tryLoadSensorData(&server, packet, true) {
+		t.Fatal("should fail to load packet encrypted with wrong key")
+	}
+}
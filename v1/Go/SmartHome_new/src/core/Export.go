@@ -0,0 +1,306 @@
+package core
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"smartHome/src/core/entities"
+	"smartHome/src/core/files"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Offline raw data export:
+// SmartHome_new iniFileName export -start YYYYMMDD -end YYYYMMDD [-format csv|columns] [-sensors 1,2] [-out fileName]
+// Every row contains one property value, timestamps are ISO-8601 in the configured time zone,
+// values are converted from the stored x100 integers.
+// csv - comma separated rows with header,
+// columns - json object containing array of values for every column for every day (json lines).
+
+var exportColumns = []string{"timestamp", "sensor_id", "sensor_name", "location", "data_type", "property", "value"}
+
+type exportRow struct {
+	timestamp time.Time
+	sensorId  int
+	property  string
+	value     int
+}
+
+type exportWriter interface {
+	write(row exportRow) error
+	// called after rows of every day are written
+	endDay() error
+	close() error
+}
+
+type exportMetadata struct {
+	sensors   map[int]entities.Sensor
+	locations map[int]entities.Location
+}
+
+func (m *exportMetadata) columns(row exportRow) []string {
+	sensor := m.sensors[row.sensorId]
+	return []string{
+		row.timestamp.Format(time.RFC3339),
+		strconv.Itoa(row.sensorId),
+		sensor.Name,
+		m.locations[sensor.LocationId].Name,
+		sensor.DataType,
+		row.property,
+		strconv.FormatFloat(float64(row.value)/100, 'f', -1, 64),
+	}
+}
+
+type csvExportWriter struct {
+	metadata *exportMetadata
+	writer   *csv.Writer
+}
+
+func newCsvExportWriter(w io.Writer, metadata *exportMetadata) (*csvExportWriter, error) {
+	writer := csv.NewWriter(w)
+	err := writer.Write(exportColumns)
+	if err != nil {
+		return nil, err
+	}
+	return &csvExportWriter{metadata: metadata, writer: writer}, nil
+}
+
+func (w *csvExportWriter) write(row exportRow) error {
+	return w.writer.Write(w.metadata.columns(row))
+}
+
+func (w *csvExportWriter) endDay() error {
+	return nil
+}
+
+func (w *csvExportWriter) close() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+// column values of a day are collected in memory and written as one json object
+type columnsExportWriter struct {
+	metadata *exportMetadata
+	w        io.Writer
+	columns  [][]any
+	written  bool
+}
+
+func newColumnsExportWriter(w io.Writer, metadata *exportMetadata) *columnsExportWriter {
+	return &columnsExportWriter{metadata: metadata, w: w, columns: make([][]any, len(exportColumns))}
+}
+
+func (w *columnsExportWriter) write(row exportRow) error {
+	values := w.metadata.columns(row)
+	for i, v := range values {
+		w.columns[i] = append(w.columns[i], v)
+	}
+	// numeric columns
+	w.columns[1][len(w.columns[1])-1] = row.sensorId
+	w.columns[6][len(w.columns[6])-1] = float64(row.value) / 100
+	return nil
+}
+
+func (w *columnsExportWriter) endDay() error {
+	if len(w.columns[0]) == 0 {
+		return nil
+	}
+	return w.writeColumns()
+}
+
+func (w *columnsExportWriter) writeColumns() error {
+	result := make(map[string][]any)
+	for i, name := range exportColumns {
+		result[name] = w.columns[i]
+		if result[name] == nil {
+			result[name] = []any{}
+		}
+		w.columns[i] = nil
+	}
+	w.written = true
+	return json.NewEncoder(w.w).Encode(result)
+}
+
+// writes empty columns when there is no data
+func (w *columnsExportWriter) close() error {
+	if w.written {
+		return nil
+	}
+	return w.writeColumns()
+}
+
+type exportParameters struct {
+	start     int
+	end       int
+	format    string
+	sensorIds map[int]bool
+	out       string
+}
+
+func parseDateParameter(name string, value string) (int, error) {
+	date, err := strconv.Atoi(value)
+	if err != nil || len(value) != 8 {
+		return 0, fmt.Errorf("invalid %v parameter %v", name, value)
+	}
+	return date, nil
+}
+
+func parseExportParameters(args []string) (*exportParameters, error) {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	start := flags.String("start", "", "first date, YYYYMMDD")
+	end := flags.String("end", "", "last date, YYYYMMDD")
+	format := flags.String("format", "csv", "output format: csv or columns")
+	sensors := flags.String("sensors", "", "comma separated sensor ids, all sensors by default")
+	out := flags.String("out", "-", "output file name, - for standard output")
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+	if flags.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected export arguments: %v", flags.Args())
+	}
+	params := exportParameters{format: *format, out: *out}
+	params.start, err = parseDateParameter("start", *start)
+	if err != nil {
+		return nil, err
+	}
+	params.end, err = parseDateParameter("end", *end)
+	if err != nil {
+		return nil, err
+	}
+	if params.end < params.start {
+		return nil, fmt.Errorf("end date is before start date")
+	}
+	if params.format != "csv" && params.format != "columns" {
+		return nil, fmt.Errorf("invalid format %v", params.format)
+	}
+	if len(*sensors) > 0 {
+		params.sensorIds = make(map[int]bool)
+		for _, s := range strings.Split(*sensors, ",") {
+			id, err := strconv.Atoi(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid sensor id %v", s)
+			}
+			params.sensorIds[id] = true
+		}
+	}
+	return &params, nil
+}
+
+// returns rows of the day sorted by time, sensor id and property
+func buildExportRows(date int, data map[int][]entities.SensorData, sensorIds map[int]bool) []exportRow {
+	var rows []exportRow
+	for sensorId, v := range data {
+		if sensorIds != nil && !sensorIds[sensorId] {
+			continue
+		}
+		for i := range v {
+			var timestamp time.Time
+			if v[i].Timestamp != 0 {
+				timestamp = time.Unix(v[i].Timestamp, 0).In(timeZone)
+			} else {
+				timestamp = eventTime(date, v[i].EventTime)
+			}
+			for property, value := range v[i].Data.Values {
+				rows = append(rows, exportRow{timestamp: timestamp, sensorId: sensorId, property: property, value: value})
+			}
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if !rows[i].timestamp.Equal(rows[j].timestamp) {
+			return rows[i].timestamp.Before(rows[j].timestamp)
+		}
+		if rows[i].sensorId != rows[j].sensorId {
+			return rows[i].sensorId < rows[j].sensorId
+		}
+		return rows[i].property < rows[j].property
+	})
+	return rows
+}
+
+func exportData(storage *files.FileStorage, params *exportParameters, writer exportWriter) (int, error) {
+	count := 0
+	for date := params.start; date <= params.end; date = nextDate(date) {
+		providers, ok := storage.Files[date]
+		if !ok {
+			continue
+		}
+		data, err := entities.ReadSensorDataFromJson(providers)
+		if err != nil {
+			return 0, fmt.Errorf("%v: %v", date, err.Error())
+		}
+		for _, row := range buildExportRows(date, data, params.sensorIds) {
+			err = writer.write(row)
+			if err != nil {
+				return 0, err
+			}
+			count++
+		}
+		err = writer.endDay()
+		if err != nil {
+			return 0, err
+		}
+	}
+	return count, writer.close()
+}
+
+func Export(iniFileName string, args []string) error {
+	params, err := parseExportParameters(args)
+	if err != nil {
+		return err
+	}
+	config, err := loadConfiguration(iniFileName)
+	if err != nil {
+		return err
+	}
+	setTimeZone(config.location)
+	metadata := exportMetadata{}
+	metadata.locations, err = readLocations(config.DataFolder)
+	if err != nil {
+		return err
+	}
+	metadata.sensors, err = readSensors(config.DataFolder)
+	if err != nil {
+		return err
+	}
+	storage, err := files.NewFileStorage(config.DataFolder, config.ZipFileName)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	out := os.Stdout
+	if params.out != "-" {
+		out, err = os.Create(params.out)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+	}
+	w := bufio.NewWriter(out)
+	var writer exportWriter
+	if params.format == "csv" {
+		writer, err = newCsvExportWriter(w, &metadata)
+		if err != nil {
+			return err
+		}
+	} else {
+		writer = newColumnsExportWriter(w, &metadata)
+	}
+	count, err := exportData(storage, params, writer)
+	if err != nil {
+		return err
+	}
+	err = w.Flush()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%v values exported\n", count)
+	return nil
+}
@@ -0,0 +1,99 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"smartHome/src/core/entities"
+	"smartHome/src/core/files"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExport(t *testing.T) {
+	storage, err := files.NewFileStorage("../../test_resources/db", "../../test_resources/db/db.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer storage.Close()
+	metadata := exportMetadata{
+		sensors:   map[int]entities.Sensor{1: {Id: 1, Name: "cabinet_int", DataType: "env", LocationId: 1}},
+		locations: map[int]entities.Location{1: {Id: 1, Name: "loc,1"}},
+	}
+	params, err := parseExportParameters([]string{"-start", "20210107", "-end", "20210107", "-sensors", "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	writer, err := newCsvExportWriter(&out, &metadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, err := exportData(storage, params, writer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if count == 0 || len(lines) != count+1 {
+		t.Fatalf("wrong rows count: %v", count)
+	}
+	expectedTime := time.Date(2021, 1, 7, 0, 0, 0, 0, timeZone).Format(time.RFC3339)
+	if lines[0] != "timestamp,sensor_id,sensor_name,location,data_type,property,value" ||
+		lines[1] != expectedTime+`,1,cabinet_int,"loc,1",env,humi,37.7` {
+		t.Fatalf("wrong csv: %v %v", lines[0], lines[1])
+	}
+
+	out.Reset()
+	columnsWriter := newColumnsExportWriter(&out, &metadata)
+	_, err = exportData(storage, params, columnsWriter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var columns map[string][]any
+	err = json.Unmarshal(out.Bytes(), &columns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(columns["value"]) != count || columns["value"][0] != 37.7 || columns["sensor_id"][0] != 1.0 ||
+		columns["timestamp"][0] != expectedTime {
+		t.Fatalf("wrong columns: %v %v %v", columns["value"][0], columns["sensor_id"][0], columns["timestamp"][0])
+	}
+
+	// every day is written as a separate columns object
+	out.Reset()
+	params.start = 20210101
+	params.end = 20210131
+	count, err = exportData(storage, params, newColumnsExportWriter(&out, &metadata))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines = strings.Split(strings.TrimSpace(out.String()), "\n")
+	total := 0
+	for _, line := range lines {
+		err = json.Unmarshal([]byte(line), &columns)
+		if err != nil {
+			t.Fatal(err)
+		}
+		total += len(columns["value"])
+	}
+	if len(lines) < 2 || total != count {
+		t.Fatalf("wrong columns objects: %v %v %v", len(lines), total, count)
+	}
+}
+
+func TestParseExportParameters(t *testing.T) {
+	for _, args := range [][]string{
+		{},
+		{"-start", "20210107"},
+		{"-start", "20210107", "-end", "20210106"},
+		{"-start", "20210107", "-end", "20210107", "-format", "xml"},
+		{"-start", "20210107", "-end", "20210107", "-sensors", "1,x"},
+		{"-start", "20210107", "-end", "20210107", "extra"},
+	} {
+		_, err := parseExportParameters(args)
+		if err == nil {
+			t.Fatalf("error expected for %v", args)
+		}
+	}
+}
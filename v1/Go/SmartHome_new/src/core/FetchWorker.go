@@ -0,0 +1,257 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"smartHome/src/core/files"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Every fetch address is polled by its own worker.
+// After a successful request the next request is sent after fetch interval,
+// after a failure - after BackoffMin * 2^(failures - 1) seconds (not more than BackoffMax) with random jitter.
+// While responses are full-sized (PageSize messages or more) next pages are requested, up to MaxPages requests per cycle.
+// Address cursors (time of the last fetched message) are stored in <DataFolder>/fetch_cursors.json,
+// addresses without stored cursor get it from sensor data in memory.
+
+const fetchCursorsFileName = "fetch_cursors.json"
+
+type fetcher struct {
+	key    []byte
+	config *fetchConfiguration
+	// cursors file name, empty - cursors are not stored
+	fileName string
+	mutex    sync.Mutex
+	// map address -> YYYYMMDDHHMMSS
+	cursors map[string]int64
+	changed bool
+	workers []*fetchWorker
+	stop    chan struct{}
+	running sync.WaitGroup
+}
+
+type fetchWorker struct {
+	address string
+	mutex   sync.Mutex
+	status  fetchStatus
+}
+
+type fetchStatus struct {
+	Address             string
+	Cursor              int64
+	LastSuccess         *time.Time `json:",omitempty"`
+	LastFailure         *time.Time `json:",omitempty"`
+	LastError           string     `json:",omitempty"`
+	ConsecutiveFailures int
+	// false after Retries consecutive failures
+	Healthy     bool
+	NextAttempt time.Time
+}
+
+func newFetcher(key []byte, config *fetchConfiguration, dataFolder string) (*fetcher, error) {
+	f := fetcher{
+		key:     key,
+		config:  config,
+		cursors: make(map[string]int64),
+		stop:    make(chan struct{}),
+	}
+	if len(dataFolder) > 0 {
+		f.fileName = dataFolder + string(os.PathSeparator) + fetchCursorsFileName
+		dat, err := os.ReadFile(f.fileName)
+		if err == nil {
+			err = json.Unmarshal(dat, &f.cursors)
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("fetch cursors file read error: %v", err.Error())
+		}
+	}
+	for _, address := range config.Addresses {
+		f.workers = append(f.workers, &fetchWorker{address: address, status: fetchStatus{Address: address, Healthy: true}})
+	}
+	return &f, nil
+}
+
+func (f *fetcher) getCursor(address string) (int64, bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	cursor, ok := f.cursors[address]
+	return cursor, ok
+}
+
+func (f *fetcher) setCursor(address string, cursor int64) {
+	f.mutex.Lock()
+	f.cursors[address] = cursor
+	f.changed = true
+	f.mutex.Unlock()
+}
+
+func (f *fetcher) updateCursor(address string, cursor int64) {
+	f.mutex.Lock()
+	if cursor > f.cursors[address] {
+		f.cursors[address] = cursor
+		f.changed = true
+	}
+	f.mutex.Unlock()
+}
+
+func (f *fetcher) saveCursors() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if len(f.fileName) == 0 || !f.changed {
+		return nil
+	}
+	dat, err := json.Marshal(f.cursors)
+	if err != nil {
+		return err
+	}
+	err = files.ReplaceFile(f.fileName, dat)
+	if err == nil {
+		f.changed = false
+	}
+	return err
+}
+
+func (f *fetcher) start(server *Server) {
+	for _, w := range f.workers {
+		f.running.Add(1)
+		go f.run(server, w)
+	}
+}
+
+// stops workers, waits for running requests and saves cursors
+func (f *fetcher) stopWorkers() {
+	close(f.stop)
+	f.running.Wait()
+	err := f.saveCursors()
+	if err != nil {
+		log.Printf("Fetch cursors save error: %v\n", err.Error())
+	}
+}
+
+func (f *fetcher) stopped() bool {
+	select {
+	case <-f.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// returns delay before the next request, random in [d/2, d] after failures
+func (f *fetcher) nextDelay(failures int) time.Duration {
+	if failures == 0 {
+		return f.config.intervalDuration
+	}
+	d := f.config.backoffMinDuration
+	for i := 1; i < failures && d < f.config.backoffMaxDuration; i++ {
+		d *= 2
+	}
+	if d > f.config.backoffMaxDuration {
+		d = f.config.backoffMaxDuration
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func (f *fetcher) run(server *Server, w *fetchWorker) {
+	defer f.running.Done()
+	for {
+		err := f.poll(server, w.address)
+		server.metrics.addFetch(w.address, err)
+		now := time.Now()
+		w.mutex.Lock()
+		if err == nil {
+			w.status.LastSuccess = &now
+			w.status.ConsecutiveFailures = 0
+			w.status.Healthy = true
+		} else {
+			log.Printf("Fetch error for %v: %v\n", w.address, err.Error())
+			w.status.LastFailure = &now
+			w.status.LastError = err.Error()
+			w.status.ConsecutiveFailures++
+			if w.status.ConsecutiveFailures >= f.config.Retries && w.status.Healthy {
+				w.status.Healthy = false
+				log.Printf("Fetch address %v is down after %v failures\n", w.address, w.status.ConsecutiveFailures)
+			}
+		}
+		delay := f.nextDelay(w.status.ConsecutiveFailures)
+		w.status.NextAttempt = now.Add(delay)
+		w.mutex.Unlock()
+		select {
+		case <-f.stop:
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (f *fetcher) poll(server *Server, address string) error {
+	timeout := f.config.timeoutDuration
+	cursor, ok := f.getCursor(address)
+	if !ok {
+		response, err := udpSend(f.key, address, "GET /sensor_data/sensors", timeout)
+		if err != nil {
+			return err
+		}
+		errorList := processSensorsResponse(server, address, response)
+		if len(errorList) > 0 {
+			return errorList[0]
+		}
+		cursor, _ = f.getCursor(address)
+	}
+	for page := 0; page < f.config.MaxPages; page++ {
+		url := "GET /sensor_data/all@" + strconv.FormatInt(cursor, 10)
+		log.Printf("fetch: address = %v, URL = %v\n", address, url)
+		response, err := udpSend(f.key, address, url, timeout)
+		if err != nil {
+			return err
+		}
+		count, errorList := processResponse(server, address, response)
+		for _, err := range errorList {
+			log.Println(err)
+		}
+		err = f.saveCursors()
+		if err != nil {
+			return err
+		}
+		next, _ := f.getCursor(address)
+		if count < f.config.PageSize || next <= cursor || f.stopped() {
+			return nil
+		}
+		cursor = next
+	}
+	log.Printf("fetch: page limit reached for %v\n", address)
+	return nil
+}
+
+func (f *fetcher) getStatus() []fetchStatus {
+	var result []fetchStatus
+	for _, w := range f.workers {
+		w.mutex.Lock()
+		status := w.status
+		w.mutex.Unlock()
+		status.Cursor, _ = f.getCursor(w.address)
+		result = append(result, status)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Address < result[j].Address })
+	return result
+}
+
+func FetcherStatusHandler(server *Server, w *bytes.Buffer) {
+	if server.fetcher == nil {
+		w.Write([]byte("[]"))
+		return
+	}
+	data, err := json.Marshal(server.fetcher.getStatus())
+	if err != nil {
+		w.Write([]byte(fmt.Sprintf("500 json.Marshal error: %v", err)))
+		return
+	}
+	w.Write(data)
+}
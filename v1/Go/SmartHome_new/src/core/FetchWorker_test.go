@@ -0,0 +1,261 @@
+package core
+
+import (
+	"fmt"
+	"net"
+	"smartHome/src/core/entities"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fake message broker answering fetcher requests
+func startTestBroker(t *testing.T, respond func(request string) string) (string, func() []string) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	var mutex sync.Mutex
+	var requests []string
+	go func() {
+		buffer := make([]byte, 10000)
+		for {
+			n, addr, err := conn.ReadFrom(buffer)
+			if err != nil {
+				return
+			}
+			request, err := AesDecode(buffer[:n], testKey, CompressNone, nil)
+			if err != nil {
+				continue
+			}
+			mutex.Lock()
+			requests = append(requests, string(request))
+			mutex.Unlock()
+			encoded, err := AesEncode([]byte(respond(string(request))), testKey, CompressGzip, nil)
+			if err == nil {
+				_, _ = conn.WriteTo(encoded, addr)
+			}
+		}
+	}()
+	return conn.LocalAddr().String(), func() []string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]string{}, requests...)
+	}
+}
+
+func deadAddress(t *testing.T) string {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := conn.LocalAddr().String()
+	conn.Close()
+	return address
+}
+
+func respondOneMessage(request string) string {
+	if strings.HasPrefix(request, "GET /sensor_data/all@") {
+		return `[{"messageTime": "2021-01-07 10:00:00", "sensorName": "s1", "message": {"temp": 20.5}}]`
+	}
+	return `["s1"]`
+}
+
+func makeFetcherTestDB() *DB {
+	return &DB{
+		Sensors: map[int]entities.Sensor{
+			1: {Id: 1, Name: "s1", DataType: "env"},
+			2: {Id: 2, Name: "s2", DataType: "env"},
+		},
+		SensorDataMap: make(map[int]map[int][]entities.SensorData),
+		DataToBeSaved: make(map[int][]int),
+	}
+}
+
+func TestFetcher(t *testing.T) {
+	live, requests := startTestBroker(t, respondOneMessage)
+	dead := deadAddress(t)
+	config := fetchConfiguration{
+		Retries:            2,
+		PageSize:           100,
+		MaxPages:           10,
+		Addresses:          []string{live, dead},
+		timeoutDuration:    200 * time.Millisecond,
+		intervalDuration:   50 * time.Millisecond,
+		backoffMinDuration: 20 * time.Millisecond,
+		backoffMaxDuration: 40 * time.Millisecond,
+	}
+	db := makeFetcherTestDB()
+	folder := t.TempDir()
+	f, err := newFetcher(testKey, &config, folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := Server{db: db, config: &configuration{}, fetcher: f}
+	f.start(&server)
+
+	var status []fetchStatus
+	for i := 0; i < 100; i++ {
+		time.Sleep(20 * time.Millisecond)
+		status = f.getStatus()
+		if len(requests()) >= 3 && (!status[0].Healthy || !status[1].Healthy) {
+			break
+		}
+	}
+	f.stopWorkers()
+
+	var liveStatus, deadStatus fetchStatus
+	for _, s := range status {
+		if s.Address == live {
+			liveStatus = s
+		} else {
+			deadStatus = s
+		}
+	}
+	if !liveStatus.Healthy || liveStatus.LastSuccess == nil || liveStatus.Cursor != 20210107100000 {
+		t.Fatalf("wrong live address status: %v", liveStatus)
+	}
+	if deadStatus.Healthy || deadStatus.ConsecutiveFailures < 2 || deadStatus.LastSuccess != nil {
+		t.Fatalf("wrong dead address status: %v", deadStatus)
+	}
+	r := requests()
+	if r[0] != "GET /sensor_data/sensors" || r[1] != "GET /sensor_data/all@0" || r[2] != "GET /sensor_data/all@20210107100000" {
+		t.Fatalf("wrong requests: %v", r)
+	}
+	if len(db.SensorDataMap[20210107][1]) != 1 {
+		t.Fatal("fetched data is not saved")
+	}
+
+	// cursors are loaded from file
+	f, err = newFetcher(testKey, &config, folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cursor, ok := f.getCursor(live)
+	if !ok || cursor != 20210107100000 {
+		t.Fatalf("wrong stored cursor: %v", cursor)
+	}
+	_, ok = f.getCursor(dead)
+	if ok {
+		t.Fatal("dead address should have no cursor")
+	}
+}
+
+// every address is polled by its own worker, fetched data is saved concurrently
+func TestFetcherConcurrentAddresses(t *testing.T) {
+	respond := func(sensorName string) func(request string) string {
+		return func(request string) string {
+			if request == "GET /sensor_data/sensors" {
+				return `["` + sensorName + `"]`
+			}
+			var messages []string
+			if request == "GET /sensor_data/all@0" {
+				for minute := 0; minute < 50; minute++ {
+					messages = append(messages, fmt.Sprintf(
+						`{"messageTime": "2021-01-07 10:%02d:00", "sensorName": "%v", "message": {"temp": 20}}`,
+						minute, sensorName))
+				}
+			}
+			return "[" + strings.Join(messages, ",") + "]"
+		}
+	}
+	address1, _ := startTestBroker(t, respond("s1"))
+	address2, _ := startTestBroker(t, respond("s2"))
+	config := fetchConfiguration{
+		PageSize:           100,
+		MaxPages:           1,
+		Addresses:          []string{address1, address2},
+		timeoutDuration:    time.Second,
+		intervalDuration:   time.Hour,
+		backoffMinDuration: 20 * time.Millisecond,
+		backoffMaxDuration: 40 * time.Millisecond,
+	}
+	db := makeFetcherTestDB()
+	f, err := newFetcher(testKey, &config, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := Server{db: db, config: &configuration{}, fetcher: f}
+	f.start(&server)
+	defer f.stopWorkers()
+
+	for i := 0; ; i++ {
+		db.mutex.RLock()
+		count1 := len(db.SensorDataMap[20210107][1])
+		count2 := len(db.SensorDataMap[20210107][2])
+		db.mutex.RUnlock()
+		if count1 == 50 && count2 == 50 {
+			break
+		}
+		if i == 100 {
+			t.Fatalf("fetched data is not saved: %v %v", count1, count2)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestFetcherPagination(t *testing.T) {
+	// 5 messages, 2 messages per page
+	address, requests := startTestBroker(t, func(request string) string {
+		from, _ := strconv.ParseInt(strings.TrimPrefix(request, "GET /sensor_data/all@"), 10, 64)
+		var messages []string
+		for minute := 0; minute < 5 && len(messages) < 2; minute++ {
+			if 20210107100000+int64(minute)*100 > from {
+				messages = append(messages, fmt.Sprintf(
+					`{"messageTime": "2021-01-07 10:%02d:00", "sensorName": "s1", "message": {"temp": 20}}`, minute))
+			}
+		}
+		return "[" + strings.Join(messages, ",") + "]"
+	})
+	config := fetchConfiguration{
+		PageSize:        2,
+		MaxPages:        2,
+		Addresses:       []string{address},
+		timeoutDuration: time.Second,
+	}
+	db := makeFetcherTestDB()
+	f, err := newFetcher(testKey, &config, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.setCursor(address, 20210107000000)
+	server := Server{db: db, config: &configuration{}, fetcher: f}
+
+	err = f.poll(&server, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requests()) != 2 || len(db.SensorDataMap[20210107][1]) != 4 {
+		t.Fatalf("page limit should stop fetching: %v", requests())
+	}
+	err = f.poll(&server, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := requests()
+	if len(r) != 3 || r[2] != "GET /sensor_data/all@20210107100300" || len(db.SensorDataMap[20210107][1]) != 5 {
+		t.Fatalf("not full page should stop fetching: %v", r)
+	}
+}
+
+func TestFetcherBackoff(t *testing.T) {
+	f := fetcher{config: &fetchConfiguration{
+		intervalDuration:   time.Minute,
+		backoffMinDuration: time.Second,
+		backoffMaxDuration: 10 * time.Second,
+	}}
+	if f.nextDelay(0) != time.Minute {
+		t.Fatal("fetch interval expected after success")
+	}
+	for failures, maxDelay := range map[int]time.Duration{1: time.Second, 3: 4 * time.Second, 10: 10 * time.Second} {
+		for i := 0; i < 10; i++ {
+			d := f.nextDelay(failures)
+			if d < maxDelay/2 || d > maxDelay {
+				t.Fatalf("wrong delay %v for %v failures", d, failures)
+			}
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package core
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const httpTokenContext = "SmartHome_new HTTP API"
+
+// slow clients can't hold connections open indefinitely
+const (
+	httpReadHeaderTimeout = 10 * time.Second
+	httpReadTimeout       = 30 * time.Second
+	httpWriteTimeout      = 2 * time.Minute
+	httpIdleTimeout       = 2 * time.Minute
+)
+
+type httpHandler struct {
+	server *Server
+	token  string
+}
+
+// bearer token for the HTTP API: hex encoded HMAC-SHA256 of httpTokenContext with the server key
+func buildHttpToken(key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(httpTokenContext))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newHttpServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: httpReadHeaderTimeout,
+		ReadTimeout:       httpReadTimeout,
+		WriteTimeout:      httpWriteTimeout,
+		IdleTimeout:       httpIdleTimeout,
+	}
+}
+
+func httpServerStart(server *Server) error {
+	mux := http.NewServeMux()
+	mux.Handle("/sensor_data", httpHandler{server: server, token: buildHttpToken(server.key)})
+	l, err := net.Listen("tcp", ":"+strconv.Itoa(server.config.HttpPortNumber))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("HTTP server started on port %d\n", server.config.HttpPortNumber)
+	go func() {
+		err := newHttpServer(mux).Serve(l)
+		if err != nil {
+			log.Println("HTTP server error: ", err.Error())
+		}
+	}()
+	return nil
+}
+
+func (h httpHandler) authorized(request *http.Request) bool {
+	authorization := request.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "Bearer ") {
+		return false
+	}
+	return hmac.Equal([]byte(authorization[7:]), []byte(h.token))
+}
+
+func (h httpHandler) ServeHTTP(w http.ResponseWriter, request *http.Request) {
+	log.Printf("Incoming HTTP request from address %s: %s\n", request.RemoteAddr, request.URL.String())
+	h.server.metrics.addRequest("HTTP /sensor_data")
+	if !h.authorized(request) {
+		http.Error(w, "401 Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if request.Method != http.MethodGet {
+		http.Error(w, "405 Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query, err := parseSensorDataQuery(request.URL.RawQuery)
+	if err != nil {
+		http.Error(w, "400 Bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	data, err := querySensorData(h.server, query)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("500 json.Marshal error: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
@@ -0,0 +1,59 @@
+package core
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHttpSensorData(t *testing.T) {
+	config, err := loadConfiguration("../../test_resources/testConfiguration.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var db DB
+	err = db.Load(config, time.Date(2021, 2, 6, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	server := Server{key: testKey, db: &db, config: config}
+	h := httpHandler{server: &server, token: buildHttpToken(testKey)}
+
+	checkHttpStatus(t, h, "/sensor_data?data_type=env", "", http.StatusUnauthorized)
+	checkHttpStatus(t, h, "/sensor_data?data_type=env", "wrong", http.StatusUnauthorized)
+	checkHttpStatus(t, h, "/sensor_data?maxPoints=10", h.token, http.StatusBadRequest)
+	checkHttpStatus(t, h, "/sensor_data?data_type=env&period=x", h.token, http.StatusBadRequest)
+	w := checkHttpStatus(t, h, "/sensor_data?data_type=env&start=20210105&end=20210107", h.token, http.StatusOK)
+
+	var result []OutSensorData
+	err = json.Unmarshal(w.Body.Bytes(), &result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 5 {
+		t.Fatalf("wrong result length: %v", len(result))
+	}
+}
+
+func checkHttpStatus(t *testing.T, h httpHandler, url string, token string, expectedStatus int) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodGet, url, nil)
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, request)
+	if w.Code != expectedStatus {
+		t.Errorf("%v: wrong status code %v", url, w.Code)
+	}
+	return w
+}
+
+func TestHttpServerTimeouts(t *testing.T) {
+	srv := newHttpServer(http.NewServeMux())
+	if srv.ReadHeaderTimeout <= 0 || srv.ReadTimeout <= 0 || srv.WriteTimeout <= 0 || srv.IdleTimeout <= 0 {
+		t.Fatalf("HTTP server timeouts should be set: %+v", srv)
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"log"
 	"smartHome/src/core/entities"
-	"strconv"
 	"strings"
 	"time"
 )
@@ -18,7 +17,7 @@ type MessageDate struct {
 func (md *MessageDate) UnmarshalJSON(input []byte) error {
 	strInput := string(input)
 	strInput = strings.Trim(strInput, `"`)
-	newTime, err := time.Parse("2006-01-02 15:04:05", strInput)
+	newTime, err := time.ParseInLocation("2006-01-02 15:04:05", strInput, timeZone)
 	if err != nil {
 		return err
 	}
@@ -72,8 +71,8 @@ func decodeMessage(m interface{}) (entities.PropertyMap, string, error) {
     return entities.PropertyMap{}, "", errors.New("unknown datatype")
 }
 
-func getSensorId(db *DB, sensorName string) (int, error) {
-	for _, sensor := range db.Sensors {
+func getSensorId(sensors map[int]entities.Sensor, sensorName string) (int, error) {
+	for _, sensor := range sensors {
 		if sensor.Name == sensorName {
 			return sensor.Id, nil
 		}
@@ -81,45 +80,17 @@ func getSensorId(db *DB, sensorName string) (int, error) {
 	return 0, fmt.Errorf("sensor not found: %s", sensorName)
 }
 
-func processAddress(server *Server, timeout time.Duration, address string, key []byte, isSensors bool,
-	                responseProcessor func(*Server, string, []byte) []error) {
-	var response []byte
-	var err error
-	retryCount := server.config.FetchConfiguration.Retries
-	url := "GET /sensor_data/sensors"
-	if !isSensors {
-		server.mutex.Lock()
-		url = "GET /sensor_data/all@" + strconv.FormatInt(server.fetcherTimestamp[address], 10)
-		server.mutex.Unlock()
-	}
-	for {
-		log.Printf("processAddress: URL = %v\n", url)
-		response, err = udpSend(key, address, url, timeout)
-		if err == nil {
-			break
-		}
-		log.Println(err)
-		if retryCount <= 0 {
-			return
-		}
-		retryCount--
-	}
-
-	errorList := responseProcessor(server, address, response)
-	for _, err := range errorList {
-		log.Println(err)
-	}
-}
-
-func processResponse(server *Server, address string, response []byte) []error {
+// returns number of messages in the response
+func processResponse(server *Server, address string, response []byte) (int, []error) {
 	messages, err := unmarshalResponse(response)
 	if err != nil {
-		return []error{err}
+		return 0, []error{err}
 	}
 
 	var result []error
+	sensors, _ := server.db.getMetadata()
 	for _, message := range messages {
-		sensorId, err := getSensorId(server.db, message.SensorName)
+		sensorId, err := getSensorId(sensors, message.SensorName)
 		if err != nil {
 			result = append(result, err)
 			continue
@@ -127,17 +98,12 @@ func processResponse(server *Server, address string, response []byte) []error {
 
 		err = server.db.saveSensorData(sensorId, message)
 		if err == nil {
-			f := fromTime(message.MessageTime)
-			server.mutex.Lock()
-			if f > server.fetcherTimestamp[address] {
-				server.fetcherTimestamp[address] = f
-			}
-			server.mutex.Unlock()
+			server.fetcher.updateCursor(address, fromTime(message.MessageTime))
 		} else {
 			result = append(result, err)
 		}
 	}
-	return result
+	return len(messages), result
 }
 
 func processSensorsResponse(server *Server, address string, response []byte) []error {
@@ -151,7 +117,7 @@ func processSensorsResponse(server *Server, address string, response []byte) []e
 	var from int64 = 0
 	server.db.mutex.Lock()
 	for _, sensorName := range sensors {
-		sensorId, err := getSensorId(server.db, sensorName)
+		sensorId, err := getSensorId(server.db.Sensors, sensorName)
 		if err != nil {
 			result = append(result, err)
 			continue
@@ -172,39 +138,9 @@ func processSensorsResponse(server *Server, address string, response []byte) []e
 	server.db.mutex.Unlock()
 
 	if len(result) == 0 {
-		server.mutex.Lock()
 		log.Printf("address: %v, from = %v\n", address, from)
-		server.fetcherTimestamp[address] = from
-		server.mutex.Unlock()
+		server.fetcher.setCursor(address, from)
 	}
 
 	return result
 }
-
-func fetcherInit(server *Server, key []byte) {
-	cont := true
-	for cont {
-		cont = false
-		for _, address := range server.config.FetchConfiguration.Addresses {
-			server.mutex.Lock()
-			_, ok := server.fetcherTimestamp[address]
-			server.mutex.Unlock()
-			if !ok {
-				processAddress(server, server.config.FetchConfiguration.timeoutDuration, address, key, true, processSensorsResponse)
-				cont = true
-			}
-		}
-	}
-}
-
-func fetchData(server *Server, key []byte) {
-	for _, address := range server.config.FetchConfiguration.Addresses {
-		server.mutex.Lock()
-		_, ok := server.fetcherTimestamp[address]
-		server.mutex.Unlock()
-		if ok {
-			processAddress(server, server.config.FetchConfiguration.timeoutDuration, address, key, false, processResponse)
-		}
-	}
-}
-
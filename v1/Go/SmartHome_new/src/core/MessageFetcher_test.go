@@ -21,7 +21,7 @@ func TestMessageDecoding(t *testing.T) {
     if l != 1 {
         t.Fatalf("wrong messages length: %v", l)
     }
-    if messages[0].MessageTime != time.Date(2020, 1, 2, 15, 4, 59, 0, time.UTC) {
+    if !messages[0].MessageTime.Equal(time.Date(2020, 1, 2, 15, 4, 59, 0, timeZone)) {
         t.Errorf("wrong message time: %v", messages[0].MessageTime)
     }
     if messages[0].SensorName != "test_ee" {
@@ -82,7 +82,7 @@ func TestErrorDecoding(t *testing.T) {
     if l != 1 {
         t.Fatalf("wrong messages length: %v", l)
     }
-    if messages[0].MessageTime != time.Date(2020, 1, 2, 15, 4, 45, 0, time.UTC) {
+    if !messages[0].MessageTime.Equal(time.Date(2020, 1, 2, 15, 4, 45, 0, timeZone)) {
         t.Errorf("wrong message time: %v", messages[0].MessageTime)
     }
     if messages[0].SensorName != "test_ee" {
@@ -126,7 +126,7 @@ func TestLogReplay(t *testing.T) {
             }
 
             for _, message := range messages {
-                sensorId, err := getSensorId(&db, message.SensorName)
+                sensorId, err := getSensorId(db.Sensors, message.SensorName)
                 if err != nil {
                     t.Fatal(err)
                 }
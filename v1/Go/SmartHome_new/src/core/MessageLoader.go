@@ -6,21 +6,51 @@ import (
 	"encoding/binary"
 	"log"
 	"smartHome/src/core/entities"
+	"sync"
 	"time"
 )
 
 var deviceDataOffsets = []int{10, 13, 20, 23, 26, 29, 36, 39, 42, 45}
 
+// devices send values multiplied by 100 except listed ones
+var deviceValueMultipliers = map[string]int32{"pwr": 100}
+
 var lastDeviceTime map[int]uint32
+var lastDeviceTimeMutex sync.Mutex
 
 func init() {
 	lastDeviceTime = make(map[int]uint32)
 }
 
-func tryLoadSensorData(server *Server, data []byte, timeOffset int, useDeviceTime bool) bool {
+func tryLoadSensorData(server *Server, data []byte, useDeviceTime bool) bool {
 	if server.deviceKey == nil {
 		return false
 	}
+	if isDevicePacketV2(data) {
+		packet, err := decodeDevicePacketV2(server.deviceKey, data)
+		if err == nil {
+			return loadDevicePacket(server, packet, useDeviceTime)
+		}
+	}
+	return tryLoadOldFormatSensorData(server, data, useDeviceTime)
+}
+
+func loadDevicePacket(server *Server, packet *devicePacket, useDeviceTime bool) bool {
+	sensors, ok := server.db.getDeviceSensors(packet.deviceId)
+	if !ok {
+		return false
+	}
+	server.metrics.addDeviceMessage(true)
+	if !checkDeviceTime(packet.deviceId, packet.eventTime) {
+		return false
+	}
+	messages := buildPacketMessages(server.db, sensors, packet, useDeviceTime)
+	saveDeviceMessages(server, packet.deviceId, packet.eventTime, messages)
+	return true
+}
+
+// fixed size packet: 16, 32 or 48 bytes encrypted with AES-ECB, values at deviceDataOffsets
+func tryLoadOldFormatSensorData(server *Server, data []byte, useDeviceTime bool) bool {
 	l := len(data)
 	if l != 16 && l != 32 && l != 48 {
 		return false
@@ -34,12 +64,14 @@ func tryLoadSensorData(server *Server, data []byte, timeOffset int, useDeviceTim
 		block.Decrypt(data[i:], data[i:])
 	}
 	deviceID := int(binary.LittleEndian.Uint16(data[4:]))
-	sensors, ok := server.db.DeviceToSensors[deviceID]
+	sensors, ok := server.db.getDeviceSensors(deviceID)
 	if !ok {
 		return false
 	}
 	crc := binary.LittleEndian.Uint32(data)
-	if crc != calculateCRC(data, server.deviceKey) {
+	crcOk := crc == calculateCRC(data, server.deviceKey)
+	server.metrics.addDeviceMessage(crcOk)
+	if !crcOk {
 		return false
 	}
 	eventTime := binary.LittleEndian.Uint32(data[6:])
@@ -55,14 +87,29 @@ func tryLoadSensorData(server *Server, data []byte, timeOffset int, useDeviceTim
 			return false
 		}
 	}
-	if eventTime <= lastDeviceTime[deviceID] {
+	if !checkDeviceTime(deviceID, eventTime) {
 		return false
 	}
-	messages := buildMessages(server.db, sensors, data, timeOffset, eventTime, useDeviceTime)
+	messages := buildMessages(server.db, sensors, data, eventTime, useDeviceTime)
 	if messages == nil {
 		return false
 	}
+	saveDeviceMessages(server, deviceID, eventTime, messages)
+	return true
+}
+
+// returns false for repeated or old packets
+func checkDeviceTime(deviceID int, eventTime uint32) bool {
+	lastDeviceTimeMutex.Lock()
+	last := lastDeviceTime[deviceID]
+	lastDeviceTimeMutex.Unlock()
+	return eventTime > last
+}
+
+func saveDeviceMessages(server *Server, deviceID int, eventTime uint32, messages map[int]*decodedMessage) {
+	lastDeviceTimeMutex.Lock()
 	lastDeviceTime[deviceID] = eventTime
+	lastDeviceTimeMutex.Unlock()
 	log.Printf("Received sensor message from device %v timestamp %v", deviceID, eventTime)
 	for k, v := range messages {
 		log.Printf("%v %v", k, v)
@@ -73,10 +120,35 @@ func tryLoadSensorData(server *Server, data []byte, timeOffset int, useDeviceTim
 			log.Println(err.Error())
 		}
 	}
-	return true
 }
 
-func buildMessages(db *DB, sensors []int, data []byte, timeOffset int, eventTime uint32, useDeviceTime bool) map[int]*decodedMessage {
+func deviceMessageTime(eventTime uint32, useDeviceTime bool) time.Time {
+	if useDeviceTime {
+		return time.Unix(int64(eventTime), 0)
+	}
+	return time.Now()
+}
+
+// values of device sensors without mapping are ignored
+func buildPacketMessages(db *DB, sensors []int, packet *devicePacket, useDeviceTime bool) map[int]*decodedMessage {
+	result := make(map[int]*decodedMessage)
+	t := deviceMessageTime(packet.eventTime, useDeviceTime)
+	for index, value := range packet.values {
+		realSensorId, dataName := db.GetSensor(sensors, index)
+		if dataName == "" {
+			continue
+		}
+		m, ok := result[realSensorId]
+		if !ok {
+			m = &decodedMessage{MessageTime: t, Message: entities.PropertyMap{Values: make(map[string]int)}}
+			result[realSensorId] = m
+		}
+		m.Message.Values[dataName] = value
+	}
+	return result
+}
+
+func buildMessages(db *DB, sensors []int, data []byte, eventTime uint32, useDeviceTime bool) map[int]*decodedMessage {
 	result := make(map[int]*decodedMessage)
 
 	for deviceSensorId, offset := range deviceDataOffsets {
@@ -95,21 +167,16 @@ func buildMessages(db *DB, sensors []int, data []byte, timeOffset int, eventTime
 			log.Println(err.Error())
 			return nil
 		}
-		if dataName == "pwr" {
-			sensorData *= 100
+		multiplier, ok := deviceValueMultipliers[dataName]
+		if ok {
+			sensorData *= multiplier
 		}
 		m, ok := result[realSensorId]
 		if ok {
 			m.Message.Values[dataName] = int(sensorData)
 		} else {
-			var t time.Time
-			if useDeviceTime {
-				t = time.Unix(int64(eventTime), 0).Add(time.Duration(timeOffset) * time.Hour)
-			} else {
-				t = time.Now().Add(time.Duration(timeOffset) * time.Hour)
-			}
 			m = &decodedMessage{
-				MessageTime: t,
+				MessageTime: deviceMessageTime(eventTime, useDeviceTime),
 				Message: entities.PropertyMap{
 					Values: map[string]int{
 						dataName: int(sensorData),
@@ -122,6 +189,13 @@ func buildMessages(db *DB, sensors []int, data []byte, timeOffset int, eventTime
 	return result
 }
 
+func getLastDeviceTime(deviceId int) (uint32, bool) {
+	lastDeviceTimeMutex.Lock()
+	defer lastDeviceTimeMutex.Unlock()
+	t, ok := lastDeviceTime[deviceId]
+	return t, ok
+}
+
 func calculateCRC(bytes []byte, dkey []byte) uint32 {
 	var crc uint32
 	var key uint32
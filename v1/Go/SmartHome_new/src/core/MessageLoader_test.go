@@ -44,11 +44,11 @@ func TestSensorDataLoad16(t *testing.T) {
 	}
 	block.Encrypt(buffer[:], buffer[:])
 
-	if !tryLoadSensorData(&server, buffer[:], 0, false) {
+	if !tryLoadSensorData(&server, buffer[:], false) {
 		t.Fatal("failed to load sensor data")
 	}
 
-	if tryLoadSensorData(&server, buffer[:], 0, false) {
+	if tryLoadSensorData(&server, buffer[:], false) {
 		t.Fatal("should fail to load sensor data")
 	}
 }
@@ -102,11 +102,11 @@ func TestSensorDataLoad32(t *testing.T) {
 	block.Encrypt(buffer[16:], buffer[16:])
 
 	lastDeviceTime[1] = 0
-	if !tryLoadSensorData(&server, buffer[:], 0, false) {
+	if !tryLoadSensorData(&server, buffer[:], false) {
 		t.Fatal("failed to load sensor data")
 	}
 
-	if tryLoadSensorData(&server, buffer[:], 0, false) {
+	if tryLoadSensorData(&server, buffer[:], false) {
 		t.Fatal("should fail to load sensor data")
 	}
 }
@@ -125,3 +125,24 @@ func TestCalculateCRC(t *testing.T) {
 		t.Fatal("Incorrect CRC: ", crc)
 	}
 }
+
+func TestBuildMessagesPwr(t *testing.T) {
+	db := &DB{
+		Sensors: map[int]entities.Sensor{
+			1: {Id: 1, DeviceId: 1, DeviceSensors: map[int]string{0: "pwr", 1: "temp"}},
+		},
+	}
+	var buffer [16]byte
+	buffer[10] = 12
+	buffer[13] = 0xE8
+	buffer[14] = 0x03 // 1000
+	messages := buildMessages(db, []int{1}, buffer[:], 10, true)
+	m, ok := messages[1]
+	if !ok {
+		t.Fatal("no message")
+	}
+	// devices send pwr values not multiplied by 100
+	if m.Message.Values["pwr"] != 1200 || m.Message.Values["temp"] != 1000 {
+		t.Fatalf("wrong values %v", m.Message.Values)
+	}
+}
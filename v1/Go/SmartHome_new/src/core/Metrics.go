@@ -0,0 +1,320 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"smartHome/src/core/entities"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Optional Prometheus metrics endpoint: GET http://MetricsAddress:MetricsPortNumber/metrics
+// (text exposition format 0.0.4, no authorization, so the server listens on 127.0.0.1 unless MetricsAddress is set).
+// Server counters are collected only when MetricsPortNumber is set, nil *serverMetrics ignores all updates.
+
+var metricsGetPaths = []string{"/sensor_data", "/sensor_status", "/totals", "/fetcher_status", "/alerts"}
+
+type latestSensorValue struct {
+	value int
+	// unix seconds
+	timestamp int64
+}
+
+type serverMetrics struct {
+	mutex sync.Mutex
+	// map request name -> count
+	requests       map[string]int64
+	decodeFailures int64
+	deviceMessages int64
+	crcFailures    int64
+	// map address -> count
+	fetchRequests map[string]int64
+	fetchErrors   map[string]int64
+	backups       int64
+	backupSeconds float64
+	// map sensorId -> property -> latest value
+	latest map[int]map[string]latestSensorValue
+}
+
+// builds latest sensor values from raw sensor data in memory
+func newServerMetrics(db *DB) *serverMetrics {
+	m := serverMetrics{
+		requests:      make(map[string]int64),
+		fetchRequests: make(map[string]int64),
+		fetchErrors:   make(map[string]int64),
+		latest:        make(map[int]map[string]latestSensorValue),
+	}
+	db.mutex.RLock()
+	for date, sensors := range db.SensorDataMap {
+		for sensorId, data := range sensors {
+			for _, d := range data {
+				m.process(sensorId, date, d)
+			}
+		}
+	}
+	db.mutex.RUnlock()
+	return &m
+}
+
+// sensorDataListener
+func (m *serverMetrics) process(sensorId int, date int, data entities.SensorData) {
+	timestamp := sampleTime(date, &data)
+	m.mutex.Lock()
+	values, ok := m.latest[sensorId]
+	if !ok {
+		values = make(map[string]latestSensorValue)
+		m.latest[sensorId] = values
+	}
+	for property, value := range data.Data.Values {
+		if timestamp >= values[property].timestamp {
+			values[property] = latestSensorValue{value: value, timestamp: timestamp}
+		}
+	}
+	m.mutex.Unlock()
+}
+
+// returns request name used as metrics label, unknown commands are reported as "invalid"
+func requestName(command string) string {
+	command = strings.TrimPrefix(command, "CHUNKED ")
+	name, rest, _ := strings.Cut(command, " ")
+	switch name {
+	case "RELOAD", "RESEND", "SUBSCRIBE", "UNSUBSCRIBE", "POST", "PUT", "DELETE":
+		return name
+	case "GET":
+		path, _, _ := strings.Cut(rest, "?")
+		for _, p := range metricsGetPaths {
+			if path == p {
+				return "GET " + path
+			}
+		}
+	}
+	return "invalid"
+}
+
+func (m *serverMetrics) addRequest(name string) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	m.requests[name]++
+	m.mutex.Unlock()
+}
+
+func (m *serverMetrics) addDecodeFailure() {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	m.decodeFailures++
+	m.mutex.Unlock()
+}
+
+func (m *serverMetrics) addDeviceMessage(crcOk bool) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	m.deviceMessages++
+	if !crcOk {
+		m.crcFailures++
+	}
+	m.mutex.Unlock()
+}
+
+func (m *serverMetrics) addFetch(address string, err error) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	m.fetchRequests[address]++
+	if err != nil {
+		m.fetchErrors[address]++
+	}
+	m.mutex.Unlock()
+}
+
+func (m *serverMetrics) addBackup(duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	m.backups++
+	m.backupSeconds += duration.Seconds()
+	m.mutex.Unlock()
+}
+
+type metricsWriter struct {
+	w *bytes.Buffer
+}
+
+func (w metricsWriter) header(name string, metricType string, help string) {
+	fmt.Fprintf(w.w, "# HELP %v %v\n# TYPE %v %v\n", name, help, name, metricType)
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labels - label name, value pairs
+func (w metricsWriter) sample(name string, value float64, labels ...string) {
+	w.w.WriteString(name)
+	if len(labels) > 0 {
+		w.w.WriteByte('{')
+		for i := 0; i < len(labels); i += 2 {
+			if i > 0 {
+				w.w.WriteByte(',')
+			}
+			fmt.Fprintf(w.w, "%v=\"%v\"", labels[i], labelValueReplacer.Replace(labels[i+1]))
+		}
+		w.w.WriteByte('}')
+	}
+	fmt.Fprintf(w.w, " %v\n", strconv.FormatFloat(value, 'f', -1, 64))
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (m *serverMetrics) writeCounters(w metricsWriter) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	w.header("smarthome_requests_total", "counter", "UDP commands and HTTP requests by name.")
+	for _, name := range sortedKeys(m.requests) {
+		w.sample("smarthome_requests_total", float64(m.requests[name]), "request", name)
+	}
+	w.header("smarthome_decode_failures_total", "counter", "UDP commands rejected by decryption or nonce check.")
+	w.sample("smarthome_decode_failures_total", float64(m.decodeFailures))
+	w.header("smarthome_device_messages_total", "counter", "Device sensor messages with known device id.")
+	w.sample("smarthome_device_messages_total", float64(m.deviceMessages))
+	w.header("smarthome_device_crc_failures_total", "counter", "Device sensor messages rejected by CRC check.")
+	w.sample("smarthome_device_crc_failures_total", float64(m.crcFailures))
+	w.header("smarthome_fetch_requests_total", "counter", "Fetch cycles by address.")
+	for _, address := range sortedKeys(m.fetchRequests) {
+		w.sample("smarthome_fetch_requests_total", float64(m.fetchRequests[address]), "address", address)
+	}
+	w.header("smarthome_fetch_errors_total", "counter", "Failed fetch cycles by address.")
+	for _, address := range sortedKeys(m.fetchRequests) {
+		w.sample("smarthome_fetch_errors_total", float64(m.fetchErrors[address]), "address", address)
+	}
+	w.header("smarthome_backup_duration_seconds", "summary", "Sensor data backup duration.")
+	w.sample("smarthome_backup_duration_seconds_sum", m.backupSeconds)
+	w.sample("smarthome_backup_duration_seconds_count", float64(m.backups))
+}
+
+type sensorValueSample struct {
+	sensorId int
+	property string
+	latestSensorValue
+}
+
+func (m *serverMetrics) writeSensorValues(w metricsWriter, db *DB) {
+	var samples []sensorValueSample
+	m.mutex.Lock()
+	for sensorId, values := range m.latest {
+		for property, v := range values {
+			samples = append(samples, sensorValueSample{sensorId: sensorId, property: property, latestSensorValue: v})
+		}
+	}
+	m.mutex.Unlock()
+	sort.Slice(samples, func(i, j int) bool {
+		if samples[i].sensorId != samples[j].sensorId {
+			return samples[i].sensorId < samples[j].sensorId
+		}
+		return samples[i].property < samples[j].property
+	})
+
+	labels := make([][]string, len(samples))
+	db.mutex.RLock()
+	for i, s := range samples {
+		sensor, ok := db.Sensors[s.sensorId]
+		// deleted sensor
+		if !ok {
+			continue
+		}
+		labels[i] = []string{"sensor_id", strconv.Itoa(s.sensorId), "sensor", sensor.Name,
+			"location", db.Locations[sensor.LocationId].Name, "data_type", sensor.DataType, "property", s.property}
+	}
+	db.mutex.RUnlock()
+
+	w.header("smarthome_sensor_value", "gauge", "Latest sensor property value.")
+	for i, s := range samples {
+		if labels[i] != nil {
+			w.sample("smarthome_sensor_value", float64(s.value)/100, labels[i]...)
+		}
+	}
+	w.header("smarthome_sensor_timestamp_seconds", "gauge", "Time of the latest sensor property value.")
+	for i, s := range samples {
+		if labels[i] != nil {
+			w.sample("smarthome_sensor_timestamp_seconds", float64(s.timestamp), labels[i]...)
+		}
+	}
+}
+
+func writeMetrics(server *Server, buffer *bytes.Buffer) {
+	w := metricsWriter{w: buffer}
+	server.metrics.writeCounters(w)
+
+	backlog := 0
+	server.db.mutex.RLock()
+	for _, sensors := range server.db.DataToBeSaved {
+		backlog += len(sensors)
+	}
+	server.db.mutex.RUnlock()
+	w.header("smarthome_data_to_be_saved", "gauge", "Sensor days waiting for backup.")
+	w.sample("smarthome_data_to_be_saved", float64(backlog))
+
+	if server.fetcher != nil {
+		w.header("smarthome_fetch_address_up", "gauge", "1 when the fetch address is healthy.")
+		for _, status := range server.fetcher.getStatus() {
+			up := 0.0
+			if status.Healthy {
+				up = 1
+			}
+			w.sample("smarthome_fetch_address_up", up, "address", status.Address)
+		}
+	}
+
+	server.metrics.writeSensorValues(w, server.db)
+}
+
+type metricsHandler struct {
+	server *Server
+}
+
+func metricsServerStart(server *Server) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metricsHandler{server: server})
+	address := net.JoinHostPort(server.config.MetricsAddress, strconv.Itoa(server.config.MetricsPortNumber))
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Metrics server started on %v\n", address)
+	go func() {
+		err := newHttpServer(mux).Serve(l)
+		if err != nil {
+			log.Println("Metrics server error: ", err.Error())
+		}
+	}()
+	return nil
+}
+
+func (h metricsHandler) ServeHTTP(w http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		http.Error(w, "405 Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var buffer bytes.Buffer
+	writeMetrics(h.server, &buffer)
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = w.Write(buffer.Bytes())
+}
@@ -0,0 +1,98 @@
+package core
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"smartHome/src/core/entities"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestName(t *testing.T) {
+	names := map[string]string{
+		"GET /sensor_data?data_type=env": "GET /sensor_data",
+		"CHUNKED GET /totals?start=1":    "GET /totals",
+		"GET /sensor_status":             "GET /sensor_status",
+		"GET /unknown":                   "invalid",
+		"PUT /sensors/1 {}":              "PUT",
+		"RELOAD":                         "RELOAD",
+		"HELLO":                          "invalid",
+	}
+	for command, expected := range names {
+		if name := requestName(command); name != expected {
+			t.Errorf("%v: wrong request name %v", command, name)
+		}
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	db := DB{
+		Locations: map[int]entities.Location{1: {Id: 1, Name: "Room \"1\""}},
+		Sensors:   map[int]entities.Sensor{1: {Id: 1, Name: "s1", DataType: "env", LocationId: 1}},
+		SensorDataMap: map[int]map[int][]entities.SensorData{
+			20210107: {1: {
+				{EventTime: 100000, Timestamp: 1610013600, Data: entities.PropertyMap{Values: map[string]int{"temp": 2050, "humi": 4000}}},
+				{EventTime: 90000, Timestamp: 1610010000, Data: entities.PropertyMap{Values: map[string]int{"temp": 1900}}},
+			}},
+		},
+		DataToBeSaved: map[int][]int{20210107: {1, 2}},
+	}
+	server := Server{db: &db, config: &configuration{}, metrics: newServerMetrics(&db)}
+	server.metrics.process(1, 20210107, entities.SensorData{EventTime: 110000, Timestamp: 1610017200,
+		Data: entities.PropertyMap{Values: map[string]int{"temp": 2125}}})
+	server.metrics.addRequest("GET /sensor_data")
+	server.metrics.addRequest("GET /sensor_data")
+	server.metrics.addDecodeFailure()
+	server.metrics.addDeviceMessage(true)
+	server.metrics.addDeviceMessage(false)
+	server.metrics.addFetch("a:1", nil)
+	server.metrics.addFetch("a:1", errors.New("timeout"))
+	server.metrics.addBackup(1500 * time.Millisecond)
+
+	h := metricsHandler{server: &server}
+	request := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, request)
+	if w.Code != http.StatusOK {
+		t.Fatalf("wrong status code %v", w.Code)
+	}
+	body := w.Body.String()
+	labels := `{sensor_id="1",sensor="s1",location="Room \"1\"",data_type="env",property=`
+	for _, line := range []string{
+		"# TYPE smarthome_requests_total counter",
+		`smarthome_requests_total{request="GET /sensor_data"} 2`,
+		"smarthome_decode_failures_total 1",
+		"smarthome_device_messages_total 2",
+		"smarthome_device_crc_failures_total 1",
+		`smarthome_fetch_requests_total{address="a:1"} 2`,
+		`smarthome_fetch_errors_total{address="a:1"} 1`,
+		"smarthome_backup_duration_seconds_sum 1.5",
+		"smarthome_backup_duration_seconds_count 1",
+		"smarthome_data_to_be_saved 2",
+		"smarthome_sensor_value" + labels + `"humi"} 40`,
+		"smarthome_sensor_value" + labels + `"temp"} 21.25`,
+		"smarthome_sensor_timestamp_seconds" + labels + `"temp"} 1610017200`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("missing line %v in\n%v", line, body)
+		}
+	}
+
+	request = httptest.NewRequest(http.MethodPost, "/metrics", nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, request)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("wrong status code %v", w.Code)
+	}
+}
+
+func TestNilMetrics(t *testing.T) {
+	var m *serverMetrics
+	m.addRequest("RELOAD")
+	m.addDecodeFailure()
+	m.addDeviceMessage(false)
+	m.addFetch("a:1", nil)
+	m.addBackup(time.Second)
+}
@@ -0,0 +1,265 @@
+package core
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Minimal MQTT 3.1.1 client: QoS 0 publish and subscribe, keep alive pings.
+
+const (
+	mqttConnect       = 1
+	mqttConnack       = 2
+	mqttPublish       = 3
+	mqttPuback        = 4
+	mqttSubscribe     = 8
+	mqttSuback        = 9
+	mqttPingreq       = 12
+	mqttPingresp      = 13
+	mqttDisconnect    = 14
+	mqttMaxPacketSize = 1 << 20
+)
+
+type mqttPacket struct {
+	packetType byte
+	flags      byte
+	body       []byte
+}
+
+type mqttPublishMessage struct {
+	topic   string
+	payload []byte
+}
+
+func mqttString(s string) []byte {
+	result := binary.BigEndian.AppendUint16(nil, uint16(len(s)))
+	return append(result, s...)
+}
+
+func writeMqttPacket(w io.Writer, packetType byte, flags byte, body []byte) error {
+	packet := []byte{packetType<<4 | flags}
+	// remaining length
+	l := len(body)
+	for {
+		b := byte(l % 128)
+		l /= 128
+		if l > 0 {
+			b |= 0x80
+		}
+		packet = append(packet, b)
+		if l == 0 {
+			break
+		}
+	}
+	_, err := w.Write(append(packet, body...))
+	return err
+}
+
+func readMqttPacket(r *bufio.Reader) (*mqttPacket, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	l := 0
+	for i := 0; ; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		l |= int(b&0x7F) << (7 * i)
+		if b&0x80 == 0 {
+			break
+		}
+		if i == 3 {
+			return nil, fmt.Errorf("invalid MQTT remaining length")
+		}
+	}
+	if l > mqttMaxPacketSize {
+		return nil, fmt.Errorf("MQTT packet is too large: %v", l)
+	}
+	body := make([]byte, l)
+	_, err = io.ReadFull(r, body)
+	if err != nil {
+		return nil, err
+	}
+	return &mqttPacket{packetType: header >> 4, flags: header & 0x0F, body: body}, nil
+}
+
+// returns string and rest of data
+func readMqttString(data []byte) (string, []byte, error) {
+	if len(data) < 2 {
+		return "", nil, fmt.Errorf("invalid MQTT string")
+	}
+	l := int(binary.BigEndian.Uint16(data))
+	if len(data) < l+2 {
+		return "", nil, fmt.Errorf("invalid MQTT string")
+	}
+	return string(data[2 : l+2]), data[l+2:], nil
+}
+
+func buildMqttConnect(clientId string, userName string, password string, keepAlive int) []byte {
+	// clean session
+	flags := byte(0x02)
+	if len(userName) > 0 {
+		flags |= 0x80
+	}
+	if len(password) > 0 {
+		flags |= 0x40
+	}
+	body := append(mqttString("MQTT"), 4, flags)
+	body = binary.BigEndian.AppendUint16(body, uint16(keepAlive))
+	body = append(body, mqttString(clientId)...)
+	if len(userName) > 0 {
+		body = append(body, mqttString(userName)...)
+	}
+	if len(password) > 0 {
+		body = append(body, mqttString(password)...)
+	}
+	return body
+}
+
+func buildMqttPublish(topic string, payload []byte) []byte {
+	return append(mqttString(topic), payload...)
+}
+
+// parses PUBLISH packet, returns packet id for QoS 1 and 2
+func parseMqttPublish(p *mqttPacket) (*mqttPublishMessage, uint16, error) {
+	topic, rest, err := readMqttString(p.body)
+	if err != nil {
+		return nil, 0, err
+	}
+	var packetId uint16
+	if p.flags&0x06 != 0 {
+		if len(rest) < 2 {
+			return nil, 0, fmt.Errorf("invalid MQTT publish packet")
+		}
+		packetId = binary.BigEndian.Uint16(rest)
+		rest = rest[2:]
+	}
+	return &mqttPublishMessage{topic: topic, payload: rest}, packetId, nil
+}
+
+// MQTT topic filter matching with + and # wildcards
+func mqttTopicMatches(filter string, topic string) bool {
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+	for i, f := range filterLevels {
+		if f == "#" {
+			return true
+		}
+		if i >= len(topicLevels) || (f != "+" && f != topicLevels[i]) {
+			return false
+		}
+	}
+	return len(filterLevels) == len(topicLevels)
+}
+
+type mqttConnection struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	timeout time.Duration
+	// serializes packet writes
+	mutex    sync.Mutex
+	packetId uint16
+}
+
+// connects to the broker and waits for CONNACK
+func mqttDial(address string, connect []byte, timeout time.Duration) (*mqttConnection, error) {
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	c := mqttConnection{conn: conn, reader: bufio.NewReader(conn), timeout: timeout}
+	err = c.write(mqttConnect, 0, connect)
+	if err == nil {
+		_ = conn.SetReadDeadline(time.Now().Add(timeout))
+		var p *mqttPacket
+		p, err = readMqttPacket(c.reader)
+		if err == nil && (p.packetType != mqttConnack || len(p.body) != 2) {
+			err = fmt.Errorf("unexpected MQTT packet type %v", p.packetType)
+		}
+		if err == nil && p.body[1] != 0 {
+			err = fmt.Errorf("MQTT connection refused, return code %v", p.body[1])
+		}
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (c *mqttConnection) write(packetType byte, flags byte, body []byte) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	_ = c.conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	return writeMqttPacket(c.conn, packetType, flags, body)
+}
+
+func (c *mqttConnection) publish(topic string, payload []byte, retain bool) error {
+	var flags byte
+	if retain {
+		flags = 1
+	}
+	return c.write(mqttPublish, flags, buildMqttPublish(topic, payload))
+}
+
+// sends SUBSCRIBE with QoS 0 for all topic filters, SUBACK is received by read loop
+func (c *mqttConnection) subscribe(filters []string) error {
+	c.mutex.Lock()
+	c.packetId++
+	body := binary.BigEndian.AppendUint16(nil, c.packetId)
+	c.mutex.Unlock()
+	for _, filter := range filters {
+		body = append(append(body, mqttString(filter)...), 0)
+	}
+	return c.write(mqttSubscribe, 2, body)
+}
+
+// reads packets until error, calls onMessage for every received PUBLISH
+func (c *mqttConnection) readLoop(readTimeout time.Duration, onMessage func(m *mqttPublishMessage)) error {
+	for {
+		_ = c.conn.SetReadDeadline(time.Now().Add(readTimeout))
+		p, err := readMqttPacket(c.reader)
+		if err != nil {
+			return err
+		}
+		switch p.packetType {
+		case mqttPublish:
+			m, packetId, err := parseMqttPublish(p)
+			if err != nil {
+				return err
+			}
+			if p.flags&0x06 == 2 {
+				err = c.write(mqttPuback, 0, binary.BigEndian.AppendUint16(nil, packetId))
+				if err != nil {
+					return err
+				}
+			}
+			onMessage(m)
+		case mqttSuback:
+			if len(p.body) < 2 {
+				return fmt.Errorf("invalid MQTT suback packet")
+			}
+			for _, code := range p.body[2:] {
+				if code == 0x80 {
+					return fmt.Errorf("MQTT subscription rejected")
+				}
+			}
+		case mqttPingresp:
+		default:
+			return fmt.Errorf("unexpected MQTT packet type %v", p.packetType)
+		}
+	}
+}
+
+func (c *mqttConnection) close() {
+	_ = c.write(mqttDisconnect, 0, nil)
+	_ = c.conn.Close()
+}
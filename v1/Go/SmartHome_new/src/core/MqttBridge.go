@@ -0,0 +1,302 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"smartHome/src/core/entities"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MQTT bridge.
+// Every stored sensor value is published to <TopicPrefix>/<location>/<sensor>/<property> topic,
+// payload is the value in physical units, for example 21.5.
+// Messages received from Inputs topics are stored as sensor data of the input sensor with receive time.
+// Payload is a number (property name is the last topic level) or a json object with numeric or boolean
+// properties (Zigbee2MQTT format), Properties maps payload property names to sensor property names.
+
+const defaultMqttClientId = "SmartHome_new"
+const defaultMqttTopicPrefix = "home"
+const defaultMqttKeepAlive = 60
+const defaultMqttReconnectInterval = 10
+const mqttTimeout = 10 * time.Second
+
+// messages published by the bridge goroutine, new messages are dropped when the queue is full
+const mqttPublishQueueSize = 1000
+
+type mqttInput struct {
+	// topic filter, + and # wildcards are allowed
+	Topic    string
+	SensorId int
+	// payload property -> sensor property, all payload properties are used when empty
+	Properties map[string]string
+}
+
+type mqttConfiguration struct {
+	// broker host:port, the bridge is disabled when empty
+	Address  string
+	ClientId string
+	UserName string
+	Password string
+	// publish stored sensor data
+	Publish     bool
+	Retain      bool
+	TopicPrefix string
+	Inputs      []mqttInput
+	// seconds
+	KeepAlive         int
+	ReconnectInterval int
+}
+
+func validateMqttConfiguration(config *mqttConfiguration) error {
+	if len(config.Address) == 0 {
+		if config.Publish || len(config.Inputs) > 0 {
+			return fmt.Errorf("MQTT broker address is not set")
+		}
+		return nil
+	}
+	if len(config.ClientId) == 0 {
+		config.ClientId = defaultMqttClientId
+	}
+	if len(config.TopicPrefix) == 0 {
+		config.TopicPrefix = defaultMqttTopicPrefix
+	}
+	if config.KeepAlive <= 0 {
+		config.KeepAlive = defaultMqttKeepAlive
+	}
+	if config.ReconnectInterval <= 0 {
+		config.ReconnectInterval = defaultMqttReconnectInterval
+	}
+	for _, input := range config.Inputs {
+		if len(input.Topic) == 0 || input.SensorId <= 0 {
+			return fmt.Errorf("MQTT input topic and sensor id are required")
+		}
+		// published values would be stored again
+		if config.Publish && mqttFilterOverlapsPrefix(input.Topic, config.TopicPrefix) {
+			return fmt.Errorf("MQTT input topic %v matches published topics", input.Topic)
+		}
+	}
+	return nil
+}
+
+// returns true when the topic filter can match topics starting with the prefix
+func mqttFilterOverlapsPrefix(filter string, prefix string) bool {
+	filterLevels := strings.Split(filter, "/")
+	for i, level := range strings.Split(prefix, "/") {
+		if i >= len(filterLevels) {
+			return false
+		}
+		f := filterLevels[i]
+		if f == "#" {
+			return true
+		}
+		if f != "+" && f != level {
+			return false
+		}
+	}
+	return true
+}
+
+type mqttBridge struct {
+	db     *DB
+	config *mqttConfiguration
+	mutex  sync.Mutex
+	// nil while disconnected
+	conn         *mqttConnection
+	stop         chan struct{}
+	publishQueue chan mqttPublishMessage
+}
+
+func newMqttBridge(db *DB, config *mqttConfiguration) *mqttBridge {
+	return &mqttBridge{db: db, config: config, stop: make(chan struct{}),
+		publishQueue: make(chan mqttPublishMessage, mqttPublishQueueSize)}
+}
+
+func (b *mqttBridge) start() {
+	go b.run()
+}
+
+func (b *mqttBridge) stopBridge() {
+	close(b.stop)
+}
+
+func (b *mqttBridge) connected() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.conn != nil
+}
+
+func (b *mqttBridge) run() {
+	for {
+		err := b.serve()
+		select {
+		case <-b.stop:
+			return
+		default:
+		}
+		log.Printf("MQTT broker %v: %v\n", b.config.Address, err.Error())
+		select {
+		case <-b.stop:
+			return
+		case <-time.After(time.Duration(b.config.ReconnectInterval) * time.Second):
+		}
+	}
+}
+
+// connects to the broker, subscribes to input topics and receives messages until connection error
+func (b *mqttBridge) serve() error {
+	c, err := mqttDial(b.config.Address,
+		buildMqttConnect(b.config.ClientId, b.config.UserName, b.config.Password, b.config.KeepAlive), mqttTimeout)
+	if err != nil {
+		return err
+	}
+	if len(b.config.Inputs) > 0 {
+		var filters []string
+		for _, input := range b.config.Inputs {
+			filters = append(filters, input.Topic)
+		}
+		err = c.subscribe(filters)
+		if err != nil {
+			_ = c.conn.Close()
+			return err
+		}
+	}
+	log.Printf("Connected to MQTT broker %v\n", b.config.Address)
+	b.mutex.Lock()
+	b.conn = c
+	b.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		keepAlive := time.Duration(b.config.KeepAlive) * time.Second
+		for {
+			select {
+			case <-b.stop:
+				c.close()
+				return
+			case <-done:
+				return
+			case m := <-b.publishQueue:
+				err := c.publish(m.topic, m.payload, b.config.Retain)
+				if err != nil {
+					log.Printf("MQTT publish error: %v\n", err.Error())
+				}
+			case <-time.After(keepAlive):
+				_ = c.write(mqttPingreq, 0, nil)
+			}
+		}
+	}()
+	err = c.readLoop(time.Duration(b.config.KeepAlive)*time.Second*3/2, b.ingest)
+	close(done)
+	b.mutex.Lock()
+	b.conn = nil
+	b.mutex.Unlock()
+	_ = c.conn.Close()
+	return err
+}
+
+func mqttTopicLevel(name string) string {
+	if len(name) == 0 {
+		return "unknown"
+	}
+	return strings.NewReplacer("/", "_", "+", "_", "#", "_").Replace(name)
+}
+
+// sensorDataListener, queues stored values for publishing without blocking the caller
+func (b *mqttBridge) process(sensorId int, _ int, data entities.SensorData) {
+	if !b.config.Publish || !b.connected() {
+		return
+	}
+	sensors, locations := b.db.getMetadata()
+	sensor := sensors[sensorId]
+	prefix := b.config.TopicPrefix + "/" + mqttTopicLevel(locations[sensor.LocationId].Name) + "/" +
+		mqttTopicLevel(sensor.Name) + "/"
+	for property, value := range data.Data.Values {
+		payload := strconv.FormatFloat(float64(value)/100, 'f', -1, 64)
+		select {
+		case b.publishQueue <- mqttPublishMessage{topic: prefix + mqttTopicLevel(property), payload: []byte(payload)}:
+		default:
+			log.Printf("MQTT publish queue is full, %v value is dropped\n", prefix+mqttTopicLevel(property))
+		}
+	}
+}
+
+// returns payload values in physical units
+func parseMqttPayload(topic string, payload []byte) (map[string]float64, error) {
+	result := make(map[string]float64)
+	v, err := strconv.ParseFloat(strings.TrimSpace(string(payload)), 64)
+	if err == nil {
+		result[topic[strings.LastIndex(topic, "/")+1:]] = v
+		return result, nil
+	}
+	var m map[string]any
+	err = json.Unmarshal(payload, &m)
+	if err != nil {
+		return nil, fmt.Errorf("invalid payload")
+	}
+	for name, value := range m {
+		switch vv := value.(type) {
+		case float64:
+			result[name] = vv
+		case bool:
+			if vv {
+				result[name] = 1
+			} else {
+				result[name] = 0
+			}
+		}
+	}
+	return result, nil
+}
+
+// builds sensor property values from payload values
+func (input *mqttInput) buildValues(values map[string]float64) map[string]int {
+	result := make(map[string]int)
+	for name, v := range values {
+		property := name
+		if len(input.Properties) > 0 {
+			var ok bool
+			property, ok = input.Properties[name]
+			if !ok {
+				continue
+			}
+		}
+		result[property] = int(math.Round(v * 100))
+	}
+	return result
+}
+
+// mqttConnection message handler, stores input topics messages
+func (b *mqttBridge) ingest(m *mqttPublishMessage) {
+	now := time.Now()
+	for i := range b.config.Inputs {
+		input := &b.config.Inputs[i]
+		if !mqttTopicMatches(input.Topic, m.topic) {
+			continue
+		}
+		values, err := parseMqttPayload(m.topic, m.payload)
+		if err != nil {
+			log.Printf("MQTT message %v: %v\n", m.topic, err.Error())
+			return
+		}
+		sensors, _ := b.db.getMetadata()
+		sensor, ok := sensors[input.SensorId]
+		if !ok || sensor.IsVirtual() {
+			log.Printf("MQTT message %v: unknown sensor %v\n", m.topic, input.SensorId)
+			continue
+		}
+		propertyValues := input.buildValues(values)
+		if len(propertyValues) == 0 {
+			continue
+		}
+		err = b.db.saveSensorData(input.SensorId, decodedMessage{MessageTime: now, SensorName: sensor.Name,
+			Message: entities.PropertyMap{Values: propertyValues}})
+		if err != nil {
+			log.Printf("MQTT message %v: %v\n", m.topic, err.Error())
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package core
+
+import (
+	"smartHome/src/core/entities"
+	"testing"
+	"time"
+)
+
+func TestValidateMqttConfiguration(t *testing.T) {
+	config := mqttConfiguration{Address: "localhost:1883", Inputs: []mqttInput{{Topic: "zigbee2mqtt/+", SensorId: 1}}}
+	err := validateMqttConfiguration(&config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.TopicPrefix != defaultMqttTopicPrefix || config.KeepAlive != defaultMqttKeepAlive ||
+		config.ClientId != defaultMqttClientId {
+		t.Fatalf("defaults are not set: %v", config)
+	}
+	for _, c := range []mqttConfiguration{
+		{Publish: true},
+		{Address: "localhost:1883", Inputs: []mqttInput{{Topic: "zigbee2mqtt/+"}}},
+		{Address: "localhost:1883", Publish: true, Inputs: []mqttInput{{Topic: "#", SensorId: 1}}},
+		{Address: "localhost:1883", Publish: true, Inputs: []mqttInput{{Topic: "home/room/s1/temp", SensorId: 1}}},
+		{Address: "localhost:1883", Publish: true, TopicPrefix: "a/b", Inputs: []mqttInput{{Topic: "a/+/c", SensorId: 1}}},
+	} {
+		if validateMqttConfiguration(&c) == nil {
+			t.Errorf("validation error expected for %v", c)
+		}
+	}
+}
+
+func TestParseMqttPayload(t *testing.T) {
+	values, err := parseMqttPayload("home/room/s1/temp", []byte(" 21.5\n"))
+	if err != nil || len(values) != 1 || values["temp"] != 21.5 {
+		t.Fatalf("wrong number payload values %v %v", values, err)
+	}
+	values, err = parseMqttPayload("zigbee2mqtt/door", []byte(`{"contact": true, "battery": 90, "linkquality": 60, "name": "x"}`))
+	if err != nil || len(values) != 3 || values["contact"] != 1 || values["battery"] != 90 {
+		t.Fatalf("wrong json payload values %v %v", values, err)
+	}
+	_, err = parseMqttPayload("zigbee2mqtt/door", []byte("online"))
+	if err == nil {
+		t.Fatal("payload error expected")
+	}
+}
+
+func TestMqttBridge(t *testing.T) {
+	broker := startTestMqttBroker(t)
+	db := DB{
+		Locations: map[int]entities.Location{1: {Id: 1, Name: "Room/1"}},
+		Sensors: map[int]entities.Sensor{
+			1: {Id: 1, Name: "s1", DataType: "env", LocationId: 1},
+			2: {Id: 2, Name: "s2", DataType: "env"},
+		},
+		SensorDataMap: make(map[int]map[int][]entities.SensorData),
+		DataToBeSaved: make(map[int][]int),
+	}
+	config := mqttConfiguration{
+		Address: broker.listener.Addr().String(),
+		Publish: true,
+		Inputs:  []mqttInput{{Topic: "zigbee2mqtt/+", SensorId: 2, Properties: map[string]string{"temperature": "temp"}}},
+	}
+	err := validateMqttConfiguration(&config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bridge := newMqttBridge(&db, &config)
+	db.addListener(bridge.process)
+	bridge.start()
+	defer bridge.stopBridge()
+	for i := 0; !bridge.connected() || len(broker.subscriptions()) == 0; i++ {
+		if i == 100 {
+			t.Fatal("MQTT bridge is not connected")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	err = db.saveSensorData(1, decodedMessage{MessageTime: time.Date(2021, 1, 7, 10, 0, 0, 0, time.UTC), SensorName: "s1",
+		Message: entities.PropertyMap{Values: map[string]int{"temp": 2150}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := broker.waitPublished(t)
+	if m.topic != "home/Room_1/s1/temp" || string(m.payload) != "21.5" {
+		t.Fatalf("wrong published message %v %v", m.topic, string(m.payload))
+	}
+
+	if broker.publish("zigbee2mqtt/sensor", `{"temperature": 22.25, "battery": 90}`) != 1 {
+		t.Fatal("no subscribers")
+	}
+	m = broker.waitPublished(t)
+	if m.topic != "home/unknown/s2/temp" || string(m.payload) != "22.25" {
+		t.Fatalf("wrong published message %v %v", m.topic, string(m.payload))
+	}
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	var stored []entities.SensorData
+	for _, sensors := range db.SensorDataMap {
+		stored = append(stored, sensors[2]...)
+	}
+	if len(stored) != 1 || len(stored[0].Data.Values) != 1 || stored[0].Data.Values["temp"] != 2225 {
+		t.Fatalf("wrong stored data %v", stored)
+	}
+}
+
+func TestMqttBridgePublishQueueFull(t *testing.T) {
+	db := DB{
+		Locations: map[int]entities.Location{1: {Id: 1, Name: "loc1"}},
+		Sensors:   map[int]entities.Sensor{1: {Id: 1, Name: "s1", DataType: "env", LocationId: 1}},
+	}
+	config := mqttConfiguration{Address: "localhost:1883", Publish: true}
+	err := validateMqttConfiguration(&config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bridge := newMqttBridge(&db, &config)
+	// connected, but the queue is not drained
+	bridge.conn = &mqttConnection{}
+	data := entities.SensorData{Data: entities.PropertyMap{Values: map[string]int{"temp": 2150}}}
+	for i := 0; i < mqttPublishQueueSize+10; i++ {
+		bridge.process(1, 20210107, data)
+	}
+	if len(bridge.publishQueue) != mqttPublishQueueSize {
+		t.Fatalf("wrong queue length %v", len(bridge.publishQueue))
+	}
+	m := <-bridge.publishQueue
+	if m.topic != "home/loc1/s1/temp" || string(m.payload) != "21.5" {
+		t.Fatalf("wrong queued message %v %v", m.topic, string(m.payload))
+	}
+}
@@ -0,0 +1,201 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// in-process MQTT broker: QoS 0 publish, subscribe and ping
+type testMqttBroker struct {
+	listener net.Listener
+	mutex    sync.Mutex
+	// map connection -> topic filters
+	clients   map[net.Conn][]string
+	published chan mqttPublishMessage
+}
+
+func startTestMqttBroker(t *testing.T) *testMqttBroker {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := testMqttBroker{listener: l, clients: make(map[net.Conn][]string), published: make(chan mqttPublishMessage, 100)}
+	t.Cleanup(func() { _ = l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go b.handle(conn)
+		}
+	}()
+	return &b
+}
+
+func (b *testMqttBroker) handle(conn net.Conn) {
+	defer func() {
+		b.mutex.Lock()
+		delete(b.clients, conn)
+		b.mutex.Unlock()
+		_ = conn.Close()
+	}()
+	r := bufio.NewReader(conn)
+	for {
+		p, err := readMqttPacket(r)
+		if err != nil {
+			return
+		}
+		switch p.packetType {
+		case mqttConnect:
+			b.mutex.Lock()
+			b.clients[conn] = nil
+			b.mutex.Unlock()
+			err = writeMqttPacket(conn, mqttConnack, 0, []byte{0, 0})
+		case mqttSubscribe:
+			var filters []string
+			var codes []byte
+			rest := p.body[2:]
+			for len(rest) > 0 {
+				var filter string
+				filter, rest, err = readMqttString(rest)
+				if err != nil {
+					return
+				}
+				filters = append(filters, filter)
+				codes = append(codes, 0)
+				rest = rest[1:]
+			}
+			b.mutex.Lock()
+			b.clients[conn] = append(b.clients[conn], filters...)
+			b.mutex.Unlock()
+			err = writeMqttPacket(conn, mqttSuback, 0, append(p.body[:2:2], codes...))
+		case mqttPublish:
+			m, _, err := parseMqttPublish(p)
+			if err != nil {
+				return
+			}
+			b.published <- *m
+		case mqttPingreq:
+			err = writeMqttPacket(conn, mqttPingresp, 0, nil)
+		case mqttDisconnect:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// sends message to subscribed clients, returns number of receivers
+func (b *testMqttBroker) publish(topic string, payload string) int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	count := 0
+	for conn, filters := range b.clients {
+		for _, filter := range filters {
+			if mqttTopicMatches(filter, topic) {
+				_ = writeMqttPacket(conn, mqttPublish, 0, buildMqttPublish(topic, []byte(payload)))
+				count++
+				break
+			}
+		}
+	}
+	return count
+}
+
+func (b *testMqttBroker) subscriptions() []string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	var result []string
+	for _, filters := range b.clients {
+		result = append(result, filters...)
+	}
+	return result
+}
+
+func (b *testMqttBroker) waitPublished(t *testing.T) mqttPublishMessage {
+	select {
+	case m := <-b.published:
+		return m
+	case <-time.After(5 * time.Second):
+		t.Fatal("MQTT message timeout")
+	}
+	return mqttPublishMessage{}
+}
+
+func TestMqttTopicMatches(t *testing.T) {
+	matches := map[string]bool{
+		"home/+/s1/temp|home/room/s1/temp":        true,
+		"home/#|home/room/s1/temp":                true,
+		"home/+|home/room/s1":                     false,
+		"zigbee2mqtt/sensor|zigbee2mqtt/sensor":   true,
+		"zigbee2mqtt/sensor|zigbee2mqtt/sensor2":  false,
+		"zigbee2mqtt/sensor/#|zigbee2mqtt/sensor": true,
+	}
+	for s, expected := range matches {
+		filter, topic, _ := strings.Cut(s, "|")
+		if mqttTopicMatches(filter, topic) != expected {
+			t.Errorf("%v %v: expected %v", filter, topic, expected)
+		}
+	}
+}
+
+func TestMqttPacket(t *testing.T) {
+	payload := bytes.Repeat([]byte{'1'}, 300)
+	var buffer bytes.Buffer
+	err := writeMqttPacket(&buffer, mqttPublish, 1, buildMqttPublish("home/room/s1/temp", payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 2 bytes remaining length
+	if buffer.Len() != 3+19+300 {
+		t.Fatalf("wrong packet length %v", buffer.Len())
+	}
+	p, err := readMqttPacket(bufio.NewReader(&buffer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.packetType != mqttPublish || p.flags != 1 {
+		t.Fatalf("wrong packet header %v %v", p.packetType, p.flags)
+	}
+	m, _, err := parseMqttPublish(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.topic != "home/room/s1/temp" || !bytes.Equal(m.payload, payload) {
+		t.Fatalf("wrong message %v", m.topic)
+	}
+}
+
+func TestMqttDial(t *testing.T) {
+	b := startTestMqttBroker(t)
+	c, err := mqttDial(b.listener.Addr().String(), buildMqttConnect("test", "user", "password", 10), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.publish("a/b", []byte("1"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := b.waitPublished(t)
+	if m.topic != "a/b" || string(m.payload) != "1" {
+		t.Fatalf("wrong message %v %v", m.topic, string(m.payload))
+	}
+	c.close()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = l.Close()
+	_, err = mqttDial(l.Addr().String(), buildMqttConnect("test", "", "", 10), time.Second)
+	if err == nil {
+		t.Fatal("connection error expected")
+	}
+}
@@ -1,14 +1,19 @@
 package core
 
 import (
+    "bytes"
     "encoding/binary"
     "fmt"
     "net"
+    "strconv"
+    "strings"
     "time"
 )
 
-func udpSend(key []byte, address string, command string, timeout time.Duration) ([]byte, error) {
-    data, err := AesEncode([]byte(command), key, CompressNone, func(length int) ([]byte, error) {
+const maxResendIndexes = 1000
+
+func encodeCommand(key []byte, command string) ([]byte, error) {
+    return AesEncode([]byte(command), key, CompressNone, func(length int) ([]byte, error) {
         if length < 8 {
             return nil, fmt.Errorf("nonce size must be >= 8")
         }
@@ -21,6 +26,10 @@ func udpSend(key []byte, address string, command string, timeout time.Duration)
         }
         return append(randPart, bMillis[0], bMillis[1], bMillis[2], bMillis[3], bMillis[4], bMillis[5]), nil
     })
+}
+
+func udpDial(key []byte, address string, command string) (*net.UDPConn, error) {
+    data, err := encodeCommand(key, command)
     if err != nil {
         return nil, err
     }
@@ -34,15 +43,25 @@ func udpSend(key []byte, address string, command string, timeout time.Duration)
     if err != nil {
         return nil, err
     }
-    defer conn.Close()
     err = conn.SetReadBuffer(65507)
     if err != nil {
+        conn.Close()
         return nil, err
     }
     _, err = conn.Write(data)
     if err != nil {
+        conn.Close()
         return nil, err
     }
+    return conn, nil
+}
+
+func udpSend(key []byte, address string, command string, timeout time.Duration) ([]byte, error) {
+    conn, err := udpDial(key, address, command)
+    if err != nil {
+        return nil, err
+    }
+    defer conn.Close()
     p := make([]byte, 65507)
     _ = conn.SetReadDeadline(time.Now().Add(timeout))
     var n int
@@ -63,3 +82,79 @@ func udpSend(key []byte, address string, command string, timeout time.Duration)
         return nil, fmt.Errorf("zero length response")
     }
 }
+
+// sends a command using chunked response protocol, missing chunks are requested up to retries times
+func udpSendChunked(key []byte, address string, command string, timeout time.Duration, retries int) ([]byte, error) {
+    conn, err := udpDial(key, address, "CHUNKED "+command)
+    if err != nil {
+        return nil, err
+    }
+    defer conn.Close()
+    p := make([]byte, 65507)
+    var chunks [][]byte
+    var id uint32
+    var compressionType int
+    received := 0
+    for {
+        _ = conn.SetReadDeadline(time.Now().Add(timeout))
+        n, err := conn.Read(p)
+        if err != nil {
+            if chunks == nil || retries <= 0 {
+                return nil, err
+            }
+            retries--
+            var resend []byte
+            resend, err = encodeCommand(key, buildResendCommand(id, chunks))
+            if err != nil {
+                return nil, err
+            }
+            _, err = conn.Write(resend)
+            if err != nil {
+                return nil, err
+            }
+            continue
+        }
+        chunk, err := AesDecode(p[:n], key, CompressNone, nil)
+        if err != nil {
+            return nil, err
+        }
+        if len(chunk) < chunkHeaderSize {
+            return nil, fmt.Errorf("too short chunk")
+        }
+        chunkId := binary.LittleEndian.Uint32(chunk)
+        idx := int(binary.LittleEndian.Uint16(chunk[4:]))
+        count := int(binary.LittleEndian.Uint16(chunk[6:]))
+        if chunks == nil {
+            if count == 0 {
+                return nil, fmt.Errorf("zero chunk count")
+            }
+            id = chunkId
+            compressionType = int(chunk[8])
+            chunks = make([][]byte, count)
+        } else if chunkId != id || count != len(chunks) {
+            // late chunk of another response
+            continue
+        }
+        if idx >= count || chunks[idx] != nil {
+            continue
+        }
+        chunks[idx] = chunk[chunkHeaderSize:]
+        received++
+        if received == count {
+            return decompressData(compressionType, bytes.Join(chunks, nil))
+        }
+    }
+}
+
+func buildResendCommand(id uint32, chunks [][]byte) string {
+    var missing []string
+    for i, chunk := range chunks {
+        if chunk == nil {
+            missing = append(missing, strconv.Itoa(i))
+            if len(missing) == maxResendIndexes {
+                break
+            }
+        }
+    }
+    return fmt.Sprintf("RESEND %v %v", id, strings.Join(missing, ","))
+}
@@ -55,33 +55,26 @@ func (sd *OutSensorData) aggregate(compressionLevel int, config *configuration)
 	}
 }
 
+// raw values are summed and divided by the property divider, stats sums are already divided
 func (sd *OutSensorData) calculateTotal(totalCalculation map[string]int) int {
 	total := 0
 	exists := false
-	divider := 1
+	valueSums := make(map[string]int)
 
 	// loop by date
 	for _, v := range sd.timeData {
 		// loop by sensorData
 		for _, d := range v {
-			if d.Data.Values != nil {
-				for dataType, div := range totalCalculation {
-					value, ok := d.Data.Values[dataType]
-					if ok {
-						exists = true
-						total += value
-						divider = div
-					}
+			for dataType := range totalCalculation {
+				value, ok := d.Data.Values[dataType]
+				if ok {
+					exists = true
+					valueSums[dataType] += value
 				}
-			} else {
-				for dataType /*, div*/ := range totalCalculation {
-					value, ok := d.Data.Stats[dataType]
-					if ok {
-						exists = true
-						total += value["Sum"]
-						//fmt.Printf("%v %v\n", value["Sum"], total)
-						//divider = div
-					}
+				stats, ok := d.Data.Stats[dataType]
+				if ok {
+					exists = true
+					total += stats["Sum"]
 				}
 			}
 		}
@@ -91,7 +84,15 @@ func (sd *OutSensorData) calculateTotal(totalCalculation map[string]int) int {
 		return -1
 	}
 
-	return total / divider
+	for dataType, sum := range valueSums {
+		divider := totalCalculation[dataType]
+		if divider <= 0 {
+			divider = 1
+		}
+		total += sum / divider
+	}
+
+	return total
 }
 
 func (sd *OutSensorData) buildTimeData(compressionLevel int) []SensorTimeData {
@@ -196,7 +197,7 @@ func aggregatePropertyMapStats(values []entities.PropertyMap) map[string]map[str
 							}
 						case "Avg":
 							resultMap[param] = v2 + value
-						case "Sum":
+						case "Sum", "RawSum":
 							resultMap[param] = v2 + value
 						case "Cnt":
 							resultMap[param] = v2 + value
@@ -241,10 +242,15 @@ func MakeOutSensorData(db *DB, sensorId int) *OutSensorData {
 	}
 }
 
-func aggregateResults(resultMap map[int]*OutSensorData, maxPoints int, config *configuration) []OutSensorData {
+// data is aggregated into time buckets when bucket (seconds) is set, into maxPoints points otherwise
+func aggregateResults(resultMap map[int]*OutSensorData, maxPoints int, bucket int, config *configuration) []OutSensorData {
 	result := []OutSensorData{}
 
 	for _, sensorData := range resultMap {
+		if bucket > 0 {
+			result = append(result, sensorData.aggregateBuckets(bucket, config))
+			continue
+		}
 		l := sensorData.length()
 		compressionLevel := l/maxPoints + 1
 		result = append(result, sensorData.aggregate(compressionLevel, config))
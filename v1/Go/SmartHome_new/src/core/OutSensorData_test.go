@@ -68,6 +68,20 @@ func TestOutSensorDataAggregateStats(t *testing.T) {
 	checkTotal(t, sd.timeData, &aggregated)
 }
 
+func TestOutSensorDataMixedTotal(t *testing.T) {
+	sd := OutSensorData{timeData: map[int][]entities.SensorData{
+		1: {{Data: entities.PropertyMap{Stats: map[string]map[string]int{"pwr": {"Sum": 100}}}}},
+		2: {
+			{Data: entities.PropertyMap{Values: map[string]int{"pwr": 1200, "icc": 5}}},
+			{Data: entities.PropertyMap{Values: map[string]int{"pwr": 1200, "icc": 5}}},
+		},
+	}}
+	// stats sum is already divided
+	if sd.calculateTotal(map[string]int{"pwr": 12, "icc": 1}) != 310 {
+		t.Fatal("wrong total")
+	}
+}
+
 func checkTotal(t *testing.T, timeData map[int][]entities.SensorData, aggregated *OutSensorData) {
 	expected := 0
 	div := 1
@@ -0,0 +1,106 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"smartHome/src/core/entities"
+)
+
+func readLocations(dataFolder string) (map[int]entities.Location, error) {
+	return entities.ReadLocationsFromJson(dataFolder + string(os.PathSeparator) + "locations.json")
+}
+
+func readSensors(dataFolder string) (map[int]entities.Sensor, error) {
+	return entities.ReadSensorsFromJson(dataFolder + string(os.PathSeparator) + "sensors.json")
+}
+
+func validateMetadata(sensors map[int]entities.Sensor, locations map[int]entities.Location) error {
+	for _, sensor := range sensors {
+		_, ok := locations[sensor.LocationId]
+		if !ok {
+			return fmt.Errorf("sensor %v: unknown location %v", sensor.Id, sensor.LocationId)
+		}
+	}
+	return nil
+}
+
+// sets new sensors and locations and rebuilds sensor maps
+func (a *DB) setMetadata(sensors map[int]entities.Sensor, locations map[int]entities.Location) {
+	a.mutex.Lock()
+	a.Sensors = sensors
+	a.Locations = locations
+	a.buildDataTypeMap()
+	a.buildDeviceToSensors()
+	a.buildVirtualSensorMap()
+	a.mutex.Unlock()
+}
+
+// returns current sensors and locations maps, setMetadata replaces them and they are never changed in place,
+// so returned maps can be read without DB lock
+func (a *DB) getMetadata() (map[int]entities.Sensor, map[int]entities.Location) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	return a.Sensors, a.Locations
+}
+
+func (a *DB) getDeviceSensors(deviceId int) ([]int, bool) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	sensors, ok := a.DeviceToSensors[deviceId]
+	return sensors, ok
+}
+
+// reloads locations.json and sensors.json, running state is not changed when new files are not valid
+func (a *DB) reloadMetadata(dataFolder string) (string, error) {
+	a.metadataMutex.Lock()
+	defer a.metadataMutex.Unlock()
+	locations, err := readLocations(dataFolder)
+	if err != nil {
+		return "", err
+	}
+	sensors, err := readSensors(dataFolder)
+	if err != nil {
+		return "", err
+	}
+	err = validateMetadata(sensors, locations)
+	if err != nil {
+		return "", err
+	}
+	a.mutex.RLock()
+	added := 0
+	for sensorId := range sensors {
+		_, ok := a.Sensors[sensorId]
+		if !ok {
+			added++
+		}
+	}
+	removed := len(a.Sensors) + added - len(sensors)
+	a.mutex.RUnlock()
+	a.setMetadata(sensors, locations)
+	return fmt.Sprintf("%v sensors, %v locations, %v sensors added, %v sensors removed", len(sensors),
+		len(locations), added, removed), nil
+}
+
+func (a *DB) reload(dataFolder string) {
+	fmt.Println("Reloading sensors and locations...")
+	result, err := a.reloadMetadata(dataFolder)
+	if err != nil {
+		fmt.Printf("Reload error: %v\n", err.Error())
+	} else {
+		fmt.Printf("Reloaded: %v\n", result)
+	}
+}
+
+func ReloadHandler(server *Server, w *bytes.Buffer, admin bool) {
+	if len(server.adminKey) > 0 && !admin {
+		w.Write([]byte("403 Forbidden"))
+		return
+	}
+	result, err := server.db.reloadMetadata(server.config.DataFolder)
+	if err != nil {
+		w.Write([]byte("400 Reload error: " + err.Error()))
+		return
+	}
+	w.Write([]byte(result))
+}
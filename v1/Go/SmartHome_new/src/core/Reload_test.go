@@ -0,0 +1,110 @@
+package core
+
+import (
+	"os"
+	"smartHome/src/core/entities"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReloadMetadata(t *testing.T) {
+	folder := t.TempDir()
+	locations := `[{"Id": 1, "Name": "loc1", "LocationType": "int"}]`
+	err := os.WriteFile(folder+"/locations.json", []byte(locations), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeSensors := func(sensors string) {
+		err := os.WriteFile(folder+"/sensors.json", []byte(sensors), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeSensors(`[{"Id": 1, "Name": "s1", "DataType": "env", "LocationId": 1, "DeviceId": 1}]`)
+
+	db := DB{}
+	_, err = db.reloadMetadata(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeSensors(`[{"Id": 1, "Name": "s1", "DataType": "env", "LocationId": 1, "DeviceId": 1},
+		{"Id": 2, "Name": "s2", "DataType": "ele", "LocationId": 1, "DeviceId": 2}]`)
+	result, err := db.reloadMetadata(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(result, "1 sensors added, 0 sensors removed") {
+		t.Fatalf("wrong result: %v", result)
+	}
+	if len(db.DataTypeMap["ele"]) != 1 || len(db.DeviceToSensors[2]) != 1 {
+		t.Fatal("sensor maps are not rebuilt")
+	}
+
+	for _, sensors := range []string{
+		`[{"Id": 3, "Name": "s3", "DataType": "env", "LocationId": 2}]`,
+		`[{"Id": 3, "Name": "s3", "DataType": "env", "LocationId": 1, "Expressions": {"temp": "s4.temp"}}]`,
+		`[{"Id": 3`,
+	} {
+		writeSensors(sensors)
+		_, err = db.reloadMetadata(folder)
+		if err == nil {
+			t.Fatalf("error expected for %v", sensors)
+		}
+		if len(db.Sensors) != 2 || len(db.DataTypeMap["env"]) != 1 {
+			t.Fatal("running state should not be changed")
+		}
+	}
+}
+
+// listeners and device message decoding read sensors while metadata is reloaded
+func TestSetMetadataConcurrentReaders(t *testing.T) {
+	sensors := map[int]entities.Sensor{1: {Id: 1, Name: "s1", DataType: "env", LocationId: 1, DeviceId: 1,
+		DeviceSensors: map[int]string{0: "temp"}, ExpectedInterval: 600}}
+	locations := map[int]entities.Location{1: {Id: 1, Name: "loc1"}}
+	db := DB{
+		SensorDataMap: make(map[int]map[int][]entities.SensorData),
+		DataToBeSaved: make(map[int][]int),
+	}
+	db.setMetadata(sensors, locations)
+	w := newSensorWatchdog(&db)
+	db.addListener(w.process)
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				db.setMetadata(sensors, locations)
+			}
+		}
+	}()
+	start := time.Date(2021, 1, 7, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 100; i++ {
+		deviceSensors, ok := db.getDeviceSensors(1)
+		if !ok {
+			t.Fatal("device sensors expected")
+		}
+		sensorId, _ := db.GetSensor(deviceSensors, 0)
+		err := db.saveSensorData(sensorId, decodedMessage{MessageTime: start.Add(time.Duration(i) * time.Second),
+			Message: entities.PropertyMap{Values: map[string]int{"temp": i}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j := 0; j < 100; j++ {
+			w.check(start)
+		}
+	}
+	close(done)
+	wg.Wait()
+	if len(w.getStatus(false, start)) != 1 {
+		t.Fatal("sensor status expected")
+	}
+}
@@ -0,0 +1,184 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"smartHome/src/core/entities"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// retention periods in days, 0 - data is kept forever
+type retentionPolicy struct {
+	// raw data in dates_new folder, expired files are moved to month zip files next to the zip file,
+	// requires ZipFileName
+	Raw int
+	// rollup data
+	Rollup int
+	// daily aggregates
+	Day int
+}
+
+const defaultRetentionPolicy = "default"
+
+func expired(days int, retentionDays int) bool {
+	return retentionDays > 0 && days > retentionDays
+}
+
+// returns number of calendar days between the date and now
+func dateAge(date int, now time.Time) int {
+	return daysBetween(date, toDate(now))
+}
+
+// returns number of calendar days between dates, days are counted in UTC to skip DST changes
+func daysBetween(date1 int, date2 int) int {
+	from := time.Date(date1/10000, time.Month((date1/100)%100), date1%100, 0, 0, 0, 0, time.UTC)
+	to := time.Date(date2/10000, time.Month((date2/100)%100), date2%100, 0, 0, 0, 0, time.UTC)
+	return int(to.Sub(from).Hours() / 24)
+}
+
+func (a *DB) getRetentionPolicy(sensorId int, retention map[string]retentionPolicy) retentionPolicy {
+	policy, ok := retention[a.Sensors[sensorId].DataType]
+	if !ok {
+		policy = retention[defaultRetentionPolicy]
+	}
+	return policy
+}
+
+// applies retention policies to memory, rollup and aggregate files and dates_new files, called once a day
+func (a *DB) applyRetention(config *configuration, now time.Time) {
+	if len(config.Retention) == 0 {
+		return
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.deleteExpiredRawData(config.Retention, now)
+	a.deleteExpiredRollupData(config.Retention, now)
+	a.deleteExpiredAggregatedData(config.Retention, now)
+	if a.storage != nil {
+		err := a.archiveExpiredFiles(config.DataFolder, config.Retention, now)
+		if err != nil {
+			fmt.Printf("Raw data archiving error: %v\n", err.Error())
+		}
+	}
+}
+
+func (a *DB) isToBeSaved(date int, sensorId int) bool {
+	for _, id := range a.DataToBeSaved[date] {
+		if id == sensorId {
+			return true
+		}
+	}
+	return false
+}
+
+// days having expired sensor data are removed from memory, other sensors data is loaded from files on demand
+func (a *DB) deleteExpiredRawData(retention map[string]retentionPolicy, now time.Time) {
+	for date, data := range a.SensorDataMap {
+		days := dateAge(date, now)
+		if len(a.DataToBeSaved[date]) > 0 {
+			continue
+		}
+		for sensorId := range data {
+			if expired(days, a.getRetentionPolicy(sensorId, retention).Raw) {
+				fmt.Printf("Deleting raw sensor data for %v...\n", date)
+				delete(a.SensorDataMap, date)
+				a.rawDataCache.remove(date)
+				if a.storage != nil {
+					err := a.storage.UpdateDate(date)
+					if err != nil {
+						fmt.Printf("File storage update error for %v: %v\n", date, err.Error())
+					}
+				}
+				break
+			}
+		}
+	}
+}
+
+func (a *DB) deleteExpiredRollupData(retention map[string]retentionPolicy, now time.Time) {
+	for date, data := range a.SensorDataRollup {
+		days := dateAge(date, now)
+		changed := false
+		for sensorId := range data {
+			if expired(days, a.getRetentionPolicy(sensorId, retention).Rollup) {
+				delete(data, sensorId)
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+		if len(data) == 0 {
+			delete(a.SensorDataRollup, date)
+			if len(a.rollupFolder) > 0 {
+				_ = os.Remove(rollupFileName(a.rollupFolder, date))
+			}
+		} else {
+			a.saveRollup(date, data)
+		}
+	}
+}
+
+func (a *DB) deleteExpiredAggregatedData(retention map[string]retentionPolicy, now time.Time) {
+	for date, data := range a.SensorDataAggregated {
+		days := dateAge(date, now)
+		changed := false
+		for sensorId := range data {
+			if expired(days, a.getRetentionPolicy(sensorId, retention).Day) {
+				delete(data, sensorId)
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+		if len(data) == 0 {
+			delete(a.SensorDataAggregated, date)
+			if len(a.aggregatedFolder) > 0 {
+				_ = os.Remove(aggregatedFileName(a.aggregatedFolder, date))
+			}
+		} else {
+			a.saveAggregated(date, data)
+		}
+	}
+}
+
+// moves expired dates_new sensor files to the zip file,
+// for dates having column file expired sensor data is merged into the column file
+func (a *DB) archiveExpiredFiles(dataFolder string, retention map[string]retentionPolicy, now time.Time) error {
+	files := make(map[int][]string)
+	for date := range a.storage.Files {
+		days := dateAge(date, now)
+		for _, name := range a.storage.DatesNewFiles(date) {
+			sensorId, ok := sensorFileId(name)
+			if ok && expired(days, a.getRetentionPolicy(sensorId, retention).Raw) && !a.isToBeSaved(date, sensorId) {
+				files[date] = append(files[date], name)
+			}
+		}
+	}
+	for date := range files {
+		if a.storage.HasColumnFile(date) {
+			data, err := entities.ReadSensorDataFromJson(a.storage.Files[date])
+			if err != nil {
+				return err
+			}
+			err = entities.WriteSensorDataToColumnFile(dataFolder, date, data)
+			if err != nil {
+				return err
+			}
+		}
+		fmt.Printf("Archiving %v raw sensor data files for %v...\n", len(files[date]), date)
+		a.rawDataCache.remove(date)
+	}
+	return a.storage.Archive(files)
+}
+
+func sensorFileId(name string) (int, bool) {
+	if !strings.HasSuffix(name, ".json") {
+		return 0, false
+	}
+	sensorId, err := strconv.Atoi(name[:len(name)-5])
+	return sensorId, err == nil
+}
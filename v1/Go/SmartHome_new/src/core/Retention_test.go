@@ -0,0 +1,117 @@
+package core
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"smartHome/src/core/entities"
+	"smartHome/src/core/files"
+	"testing"
+	"time"
+)
+
+func createTestZipFile(t *testing.T, fileName string) {
+	f, err := os.Create(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := zip.NewWriter(f)
+	fw, err := w.Create("dates_new/20200101/1.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = fw.Write([]byte("[]"))
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+}
+
+func TestApplyRetention(t *testing.T) {
+	folder := t.TempDir()
+	err := os.Mkdir(filepath.Join(folder, "dates_new"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []entities.SensorData{{EventTime: 100000, Data: entities.PropertyMap{Values: map[string]int{"temp": 100}}}}
+	for _, date := range []int{20210105, 20210301} {
+		for _, sensorId := range []int{1, 2} {
+			if !entities.WriteSensorDataToJson(folder, date, sensorId, data) {
+				t.Fatal("WriteSensorDataToJson failed")
+			}
+		}
+	}
+	zipFileName := filepath.Join(folder, "db.zip")
+	createTestZipFile(t, zipFileName)
+	storage, err := files.NewFileStorage(folder, zipFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer storage.Close()
+
+	db := DB{
+		Sensors: map[int]entities.Sensor{
+			1: {Id: 1, DataType: "env"},
+			2: {Id: 2, DataType: "ele"},
+		},
+		SensorDataMap: map[int]map[int][]entities.SensorData{20210105: {1: data, 2: data}},
+		SensorDataAggregated: map[int]map[int]entities.SensorData{
+			20210105: {1: {}, 2: {}},
+			20210301: {1: {}, 2: {}},
+		},
+		SensorDataRollup: map[int]map[int][]entities.SensorData{20210105: {1: data}},
+		DataToBeSaved:    make(map[int][]int),
+		storage:          storage,
+		rawDataCache:     newDayCache(2),
+	}
+	config := configuration{
+		DataFolder: folder,
+		Retention: map[string]retentionPolicy{
+			"env":     {Raw: 30, Rollup: 30, Day: 365},
+			"default": {Day: 30},
+		},
+	}
+	db.rawDataCache.put(20210105, db.SensorDataMap[20210105])
+	db.applyRetention(&config, time.Date(2021, 3, 10, 0, 0, 0, 0, time.UTC))
+
+	if _, ok := db.rawDataCache.get(20210105); ok {
+		t.Error("day with expired raw data should be removed from the cache")
+	}
+
+	if _, ok := db.SensorDataMap[20210105]; ok {
+		t.Error("day with expired env raw data should be deleted from memory")
+	}
+	if _, ok := db.SensorDataRollup[20210105]; ok {
+		t.Error("expired rollup data should be deleted")
+	}
+	if _, ok := db.SensorDataAggregated[20210105][2]; ok {
+		t.Error("expired ele aggregated data should be deleted")
+	}
+	if _, ok := db.SensorDataAggregated[20210105][1]; !ok {
+		t.Error("env aggregated data should be kept")
+	}
+	if _, err = os.Stat(filepath.Join(folder, "dates_new", "20210105", "1.json")); !os.IsNotExist(err) {
+		t.Error("expired file should be removed from dates_new")
+	}
+	if _, err = os.Stat(filepath.Join(folder, "dates_new", "20210105", "2.json")); err != nil {
+		t.Error("ele file should be kept in dates_new")
+	}
+	if len(storage.Files[20210105]) != 2 || len(storage.Files[20210301]) != 2 || len(storage.Files[20200101]) != 1 {
+		t.Fatal("archived files should be available from zip file")
+	}
+	if _, err = os.Stat(filepath.Join(folder, "db_202101.zip")); err != nil {
+		t.Error("expired file should be moved to month zip file")
+	}
+	r, err := zip.OpenReader(zipFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.File) != 1 {
+		t.Error("zip file should not be changed")
+	}
+	_ = r.Close()
+	raw := db.readRawDays(20210105, 20210105, false)[20210105]
+	if len(raw[1]) != 1 || len(raw[2]) != 1 || raw[1][0].Data.Values["temp"] != 100 {
+		t.Fatal("wrong archived data")
+	}
+}
@@ -0,0 +1,192 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"smartHome/src/core/entities"
+	"smartHome/src/core/files"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rollup tier: Min/Max/Avg/Cnt/Sum stats per sensor for every N minutes interval of a day.
+// EventTime of a rollup record is the interval start time.
+// Rollups of past days are stored in <DataFolder>/rollup_<N>/<date>.col files,
+// stats are stored as "property.stat" values.
+
+const defaultRollupMinutes = 60
+const defaultRollupMinPeriod = 48
+
+func rollupFolderName(dataFolder string, minutes int) string {
+	return dataFolder + string(os.PathSeparator) + "rollup_" + strconv.Itoa(minutes)
+}
+
+func rollupSensorDataArray(data map[int][]entities.SensorData, minutes int,
+	totalCalculation map[string]int) map[int][]entities.SensorData {
+	result := make(map[int][]entities.SensorData)
+	for sensorId, dataArray := range data {
+		intervals := make(map[int][]entities.SensorData)
+		for _, d := range dataArray {
+			interval := (d.EventTime/10000*60 + (d.EventTime/100)%100) / minutes
+			intervals[interval] = append(intervals[interval], d)
+		}
+		var keys []int
+		for interval := range intervals {
+			keys = append(keys, interval)
+		}
+		sort.Ints(keys)
+		var out []entities.SensorData
+		for _, interval := range keys {
+			start := interval * minutes
+			sd := aggregateSensorData(intervals[interval], totalCalculation)
+			sd.EventTime = start/60*10000 + start%60*100
+			out = append(out, sd)
+		}
+		result[sensorId] = out
+	}
+	return result
+}
+
+func flattenStats(data map[int][]entities.SensorData) map[int][]entities.SensorData {
+	result := make(map[int][]entities.SensorData)
+	for sensorId, dataArray := range data {
+		var out []entities.SensorData
+		for _, d := range dataArray {
+			values := make(map[string]int)
+			for prop, stats := range d.Data.Stats {
+				for stat, v := range stats {
+					values[prop+"."+stat] = v
+				}
+			}
+			out = append(out, entities.SensorData{EventTime: d.EventTime, Data: entities.PropertyMap{Values: values}})
+		}
+		result[sensorId] = out
+	}
+	return result
+}
+
+func unflattenStats(data map[int][]entities.SensorData) map[int][]entities.SensorData {
+	for _, dataArray := range data {
+		for i, d := range dataArray {
+			stats := make(map[string]map[string]int)
+			for key, v := range d.Data.Values {
+				idx := strings.LastIndex(key, ".")
+				if idx < 0 {
+					continue
+				}
+				prop := key[:idx]
+				m, ok := stats[prop]
+				if !ok {
+					m = make(map[string]int)
+					stats[prop] = m
+				}
+				m[key[idx+1:]] = v
+			}
+			dataArray[i].Data = entities.PropertyMap{Stats: stats}
+		}
+	}
+	return data
+}
+
+func rollupFileName(folder string, date int) string {
+	return folder + string(os.PathSeparator) + strconv.Itoa(date) + ".col"
+}
+
+// writes rollup file format file to the folder
+func writeRollupFile(folder string, fileName string, data map[int][]entities.SensorData) error {
+	bytes, err := entities.EncodeColumnData(flattenStats(data))
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(folder, 0755)
+	if err != nil {
+		return err
+	}
+	return files.ReplaceFile(fileName, bytes)
+}
+
+// returns map date -> rollup data from rollup files, missing folder is not an error
+func readRollupFiles(folder string) (map[int]map[int][]entities.SensorData, error) {
+	result := make(map[int]map[int][]entities.SensorData)
+	entries, err := os.ReadDir(folder)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return result, nil
+		}
+		return nil, err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".col") {
+			continue
+		}
+		date, err := strconv.Atoi(name[:len(name)-4])
+		if err != nil {
+			continue
+		}
+		dat, err := os.ReadFile(folder + string(os.PathSeparator) + name)
+		if err != nil {
+			return nil, err
+		}
+		data, err := entities.DecodeColumnData(dat)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", name, err.Error())
+		}
+		result[date] = unflattenStats(data)
+	}
+	return result, nil
+}
+
+// enables rollup and daily aggregate files and writes past days rollups and aggregates that are not stored yet
+func (a *DB) openRollupStorage(dataFolder string) {
+	a.rollupFolder = rollupFolderName(dataFolder, a.rollupMinutes)
+	for date, data := range a.SensorDataRollup {
+		_, err := os.Stat(rollupFileName(a.rollupFolder, date))
+		if os.IsNotExist(err) {
+			a.saveRollup(date, data)
+		}
+	}
+	a.aggregatedFolder = aggregatedFolderName(dataFolder)
+	today := toDate(time.Now())
+	for date, data := range a.SensorDataAggregated {
+		if date >= today {
+			continue
+		}
+		_, err := os.Stat(aggregatedFileName(a.aggregatedFolder, date))
+		if os.IsNotExist(err) {
+			a.saveAggregated(date, data)
+		}
+	}
+}
+
+func (a *DB) saveRollup(date int, data map[int][]entities.SensorData) {
+	if len(a.rollupFolder) == 0 {
+		return
+	}
+	err := writeRollupFile(a.rollupFolder, rollupFileName(a.rollupFolder, date), data)
+	if err != nil {
+		fmt.Printf("Rollup file write error for %v: %v\n", date, err.Error())
+	}
+}
+
+// returns rollup data for the date, for days without stored rollup it is built from raw data
+// in memory or days returned by readRawDays
+func (a *DB) getRollupData(date int, days map[int]map[int][]entities.SensorData) map[int][]entities.SensorData {
+	data, ok := a.SensorDataRollup[date]
+	if ok {
+		return data
+	}
+	raw := a.rawDayData(date, days)
+	if raw == nil {
+		return nil
+	}
+	return rollupSensorDataArray(raw, a.rollupMinutes, a.totalCalculation)
+}
+
+func (a *DB) buildRollup(date int, data map[int][]entities.SensorData, totalCalculation map[string]int) {
+	rollup := rollupSensorDataArray(data, a.rollupMinutes, totalCalculation)
+	a.SensorDataRollup[date] = rollup
+	a.saveRollup(date, rollup)
+}
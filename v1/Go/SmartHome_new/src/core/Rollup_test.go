@@ -0,0 +1,66 @@
+package core
+
+import (
+	"smartHome/src/core/entities"
+	"testing"
+	"time"
+)
+
+func TestRollupSensorDataArray(t *testing.T) {
+	data := map[int][]entities.SensorData{
+		1: {
+			{EventTime: 100500, Data: entities.PropertyMap{Values: map[string]int{"temp": 2000}}},
+			{EventTime: 102000, Data: entities.PropertyMap{Values: map[string]int{"temp": 2200}}},
+			{EventTime: 103500, Data: entities.PropertyMap{Values: map[string]int{"temp": 2400}}},
+			{EventTime: 110000, Data: entities.PropertyMap{Values: map[string]int{"temp": 1000}}},
+		},
+	}
+	rollup := rollupSensorDataArray(data, 30, nil)
+	r := rollup[1]
+	if len(r) != 3 || r[0].EventTime != 100000 || r[1].EventTime != 103000 || r[2].EventTime != 110000 {
+		t.Fatalf("wrong rollup intervals: %v", r)
+	}
+	stats := r[0].Data.Stats["temp"]
+	if stats["Min"] != 2000 || stats["Max"] != 2200 || stats["Avg"] != 2100 || stats["Cnt"] != 2 {
+		t.Fatalf("wrong rollup stats: %v", stats)
+	}
+
+	folder := t.TempDir()
+	err := writeRollupFile(folder, rollupFileName(folder, 20210107), rollup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := readRollupFiles(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r = stored[20210107][1]
+	if len(r) != 3 || r[1].EventTime != 103000 || r[1].Data.Stats["temp"]["Sum"] != 2400 {
+		t.Fatalf("wrong stored rollup: %v", r)
+	}
+}
+
+func TestFilterRollupSensorData(t *testing.T) {
+	config, err := loadConfiguration("../../test_resources/testConfiguration.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var db DB
+	now := time.Date(2021, 1, 8, 12, 0, 0, 0, time.UTC)
+	err = db.Load(config, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if selectDataTier(tierAuto, 72, config.RollupMinPeriod) != tierRollup {
+		t.Fatal("rollup tier expected")
+	}
+	result := filterSensorData(&db, 72, 0, 0, tierRollup, newSensorFilter("env"), now)
+	d, ok := result[1]
+	if !ok {
+		t.Fatal("sensor 1 must be present")
+	}
+	// one record per hour
+	if len(d.timeData[20210106]) != 24 || len(d.timeData[20210107]) != 24 || d.timeData[20210107][0].Data.Stats == nil {
+		t.Fatalf("wrong rollup data length: %v %v", len(d.timeData[20210106]), len(d.timeData[20210107]))
+	}
+}
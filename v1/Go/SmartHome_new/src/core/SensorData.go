@@ -10,64 +10,104 @@ import (
 	"time"
 )
 
-func SensorDataHandler(server *Server, w *bytes.Buffer, req string) {
+// data tiers
+const (
+	tierAuto = iota
+	tierRaw
+	tierRollup
+	tierDay
+)
+
+var tierNames = map[string]int{"raw": tierRaw, "rollup": tierRollup, "day": tierDay}
+
+type sensorDataQuery struct {
+	filter    *sensorFilter
+	maxPoints int
+	period    int
+	start     int
+	end       int
+	tier      int
+	// time bucket length in seconds, 0 - data is aggregated by maxPoints
+	bucket int
+}
+
+func parseSensorDataQuery(req string) (*sensorDataQuery, error) {
 	values, err := url.ParseQuery(req)
 	if err != nil {
-		w.Write([]byte("400 Bad request: query parsing error"))
-		return
+		return nil, fmt.Errorf("query parsing error")
 	}
-	dataType := values.Get("data_type")
-	if len(dataType) == 0 {
-		w.Write([]byte("400 Bad request: missing or empty datatype parameter"))
-		return
+	query := sensorDataQuery{
+		maxPoints: 1000000,
+	}
+	query.filter, err = parseSensorFilter(values)
+	if err != nil {
+		return nil, err
+	}
+	if values.Get("raw") == "true" {
+		query.tier = tierRaw
+	}
+	tiers := values.Get("tier")
+	if len(tiers) > 0 {
+		var ok bool
+		query.tier, ok = tierNames[tiers]
+		if !ok {
+			return nil, fmt.Errorf("invalid tier parameter %v", tiers)
+		}
+	}
+	buckets := values.Get("bucket")
+	if len(buckets) > 0 {
+		query.bucket, err = parseBucket(buckets)
+		if err != nil {
+			return nil, err
+		}
 	}
 	maxPointsValue := values.Get("maxPoints")
-	var maxPoints int
 	if len(maxPointsValue) > 0 {
-		maxPoints, err = strconv.Atoi(maxPointsValue)
-		if err != nil || maxPoints <= 0 {
-			w.Write([]byte(fmt.Sprintf("400 Bad request: invalid maxPoints parameter %v", maxPointsValue)))
-			return
+		query.maxPoints, err = strconv.Atoi(maxPointsValue)
+		if err != nil || query.maxPoints <= 0 {
+			return nil, fmt.Errorf("invalid maxPoints parameter %v", maxPointsValue)
 		}
-	} else {
-		maxPoints = 1000000
 	}
-	start := 0
-	end := 0
-	period := 0
 	starts := values.Get("start")
 	if len(starts) > 0 {
 		ends := values.Get("end")
 		if len(starts) != 8 || len(ends) != 8 {
-			w.Write([]byte(fmt.Sprintf("400 Bad request: invalid start or end parameter %v %v", starts, ends)))
-			return
+			return nil, fmt.Errorf("invalid start or end parameter %v %v", starts, ends)
 		}
-		start, err = strconv.Atoi(starts)
-		if err != nil || start <= 0 {
-			w.Write([]byte(fmt.Sprintf("400 Bad request: invalid start parameter %v", starts)))
-			return
+		query.start, err = strconv.Atoi(starts)
+		if err != nil || query.start <= 0 {
+			return nil, fmt.Errorf("invalid start parameter %v", starts)
 		}
-		end, err = strconv.Atoi(ends)
-		if err != nil || end <= 0 {
-			w.Write([]byte(fmt.Sprintf("400 Bad request: invalid end parameter %v", ends)))
-			return
+		query.end, err = strconv.Atoi(ends)
+		if err != nil || query.end <= 0 {
+			return nil, fmt.Errorf("invalid end parameter %v", ends)
 		}
 	} else {
 		periods := values.Get("period")
 		if len(periods) > 0 {
-			period, err = strconv.Atoi(periods)
-			if err != nil || period <= 0 {
-				w.Write([]byte(fmt.Sprintf("400 Bad request: invalid period parameter: %v", periods)))
-				return
+			query.period, err = strconv.Atoi(periods)
+			if err != nil || query.period <= 0 {
+				return nil, fmt.Errorf("invalid period parameter: %v", periods)
 			}
 		}
 	}
+	return &query, nil
+}
+
+func querySensorData(server *Server, query *sensorDataQuery) ([]byte, error) {
+	tier := selectDataTier(query.tier, query.period, server.config.RollupMinPeriod)
+	resultMap := filterSensorData(server.db, query.period, query.start, query.end, tier, query.filter, time.Now())
+	results := aggregateResults(resultMap, query.maxPoints, query.bucket, server.config)
+	return json.Marshal(results)
+}
 
-	server.db.mutex.Lock()
-	resultMap := filterSensorData(server.db, period, start, end, dataType, time.Now(), server.config.TimeOffset)
-	server.db.mutex.Unlock()
-	results := aggregateResults(resultMap, maxPoints, server.config)
-	data, err := json.Marshal(results)
+func SensorDataHandler(server *Server, w *bytes.Buffer, req string) {
+	query, err := parseSensorDataQuery(req)
+	if err != nil {
+		w.Write([]byte("400 Bad request: " + err.Error()))
+		return
+	}
+	data, err := querySensorData(server, query)
 	if err != nil {
 		w.Write([]byte(fmt.Sprintf("500 json.Marshal error: %v", err)))
 		return
@@ -75,45 +115,82 @@ func SensorDataHandler(server *Server, w *bytes.Buffer, req string) {
 	w.Write(data)
 }
 
+// raw data is used for latest values, start/end ranges and short periods, rollup data for longer periods,
+// daily aggregates are returned for tier=day
+func selectDataTier(requested int, period int, rollupMinPeriod int) int {
+	if requested != tierAuto {
+		return requested
+	}
+	if period > rollupMinPeriod {
+		return tierRollup
+	}
+	return tierRaw
+}
+
 // returns map sensor id -> [map date to OutSensorData]
-func filterSensorData(db *DB, period int, start int, end int, dataType string, now time.Time, timeOffset int) map[int]*OutSensorData {
+// for period queries data having timestamp is filtered by timestamp, so DST changes do not affect the period,
+// raw days missing in memory are read before the DB read lock is taken
+func filterSensorData(db *DB, period int, start int, end int, tier int, filter *sensorFilter,
+	now time.Time) map[int]*OutSensorData {
 	returnLatest := period == 0 && start == 0 && end == 0
 	if returnLatest {
 		period = 1
-	}
-	if period != 0 && timeOffset < 0 {
-		period -= timeOffset
+		tier = tierRaw
 	}
 	resultMap := make(map[int]*OutSensorData)
 	fromTime := 0
 	endTime := 235959
-	useAggregatedData := period == 0
-	if !useAggregatedData {
+	var fromTimestamp, toTimestamp int64
+	if period != 0 {
 		start, fromTime, end, endTime = fromPeriod(period, now)
+		fromTimestamp = now.Add(-time.Hour * time.Duration(period)).Unix()
+		toTimestamp = now.Unix()
 	}
-	all := dataType == "all"
+	var days map[int]map[int][]entities.SensorData
+	if tier != tierDay {
+		days = db.readRawDays(start, end, tier == tierRollup)
+	}
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
 	for start <= end {
-		if useAggregatedData {
+		if tier == tierDay {
 			data, ok := db.SensorDataAggregated[start]
 			if ok {
 				for k, v := range data {
-					if all || isValidDataType(db, k, dataType) {
-						addToResultMap(db, resultMap, start, k, v)
+					if filter.matchesSensor(db, k) {
+						v, ok = filter.filterProperties(v)
+						if ok {
+							addToResultMap(db, resultMap, start, k, v)
+						}
 					}
 				}
 			}
 		} else {
-			data, ok := db.SensorDataMap[start]
-			if ok {
+			var data map[int][]entities.SensorData
+			if tier == tierRollup {
+				data = db.getRollupData(start, days)
+			} else {
+				data = db.rawDayData(start, days)
+			}
+			if data != nil {
 				toTime := 235959
 				if start == end {
 					toTime = endTime
 				}
 				for k, v := range data {
+					if !filter.matchesSensor(db, k) {
+						continue
+					}
 					for _, d := range v {
-						if d.EventTime >= fromTime && d.EventTime <= toTime &&
-							(all || isValidDataType(db, k, dataType)) {
-							addToResultMap(db, resultMap, start, k, d)
+						inRange := d.EventTime >= fromTime && d.EventTime <= toTime
+						if period != 0 && d.Timestamp != 0 {
+							inRange = d.Timestamp >= fromTimestamp && d.Timestamp <= toTimestamp
+						}
+						if inRange && filter.matchesTime(d.EventTime) {
+							d, ok := filter.filterProperties(d)
+							if ok {
+								addToResultMap(db, resultMap, start, k, d)
+							}
 						}
 					}
 				}
@@ -197,49 +274,57 @@ type sensorStats struct {
 func aggregateSensorDataArray(data map[int][]entities.SensorData, totalCalculation map[string]int) map[int]entities.SensorData {
 	result := make(map[int]entities.SensorData)
 	for sensorId, dataArray := range data {
-		statsMap := make(map[string]*sensorStats)
-		for _, d := range dataArray {
-			for k, v := range d.Data.Values {
-				dv, ok := statsMap[k]
-				if !ok {
-					statsMap[k] = &sensorStats{
-						Min: v,
-						Avg: v,
-						Max: v,
-						Sum: v,
-						Cnt: 1,
-					}
-				} else {
-					if v < dv.Min {
-						dv.Min = v
-					}
-					if v > dv.Max {
-						dv.Max = v
-					}
-					dv.Avg += v
-					dv.Sum += v
-					dv.Cnt++
+		result[sensorId] = aggregateSensorData(dataArray, totalCalculation)
+	}
+	return result
+}
+
+func aggregateSensorData(dataArray []entities.SensorData, totalCalculation map[string]int) entities.SensorData {
+	statsMap := make(map[string]*sensorStats)
+	for _, d := range dataArray {
+		for k, v := range d.Data.Values {
+			dv, ok := statsMap[k]
+			if !ok {
+				statsMap[k] = &sensorStats{
+					Min: v,
+					Avg: v,
+					Max: v,
+					Sum: v,
+					Cnt: 1,
+				}
+			} else {
+				if v < dv.Min {
+					dv.Min = v
 				}
+				if v > dv.Max {
+					dv.Max = v
+				}
+				dv.Avg += v
+				dv.Sum += v
+				dv.Cnt++
 			}
 		}
-		out := entities.SensorData{
-			EventTime: 0,
-			Data:      entities.PropertyMap{Stats: make(map[string]map[string]int)},
+	}
+	out := entities.SensorData{
+		EventTime: 0,
+		Data:      entities.PropertyMap{Stats: make(map[string]map[string]int)},
+	}
+	for prop, stats := range statsMap {
+		div, ok := totalCalculation[prop]
+		if !ok {
+			div = 1
 		}
-		for prop, stats := range statsMap {
-			div, ok := totalCalculation[prop]
-			if !ok {
-				div = 1
-			}
-			outv := make(map[string]int)
-			outv["Min"] = stats.Min
-			outv["Max"] = stats.Max
-			outv["Avg"] = stats.Avg / stats.Cnt
-			outv["Cnt"] = stats.Cnt
-			outv["Sum"] = stats.Sum / div
-			out.Data.Stats[prop] = outv
+		outv := make(map[string]int)
+		outv["Min"] = stats.Min
+		outv["Max"] = stats.Max
+		outv["Avg"] = stats.Avg / stats.Cnt
+		outv["Cnt"] = stats.Cnt
+		outv["Sum"] = stats.Sum / div
+		if div != 1 {
+			// undivided sum for totals, Sum precision is lost
+			outv["RawSum"] = stats.Sum
 		}
-		result[sensorId] = out
+		out.Data.Stats[prop] = outv
 	}
-	return result
+	return out
 }
@@ -48,7 +48,7 @@ func TestAggregateResults(t *testing.T) {
 
 	dataMap := map[int]*OutSensorData{1: &sensor1Data, 2: &sensor2Data}
 
-	result := aggregateResults(dataMap, 3, &configuration{})
+	result := aggregateResults(dataMap, 3, 0, &configuration{})
 	if len(result) != 2 {
 		t.Fatal("Wrong result length")
 	}
@@ -98,7 +98,7 @@ func TestFilterSensorData(t *testing.T) {
 	filterTest(t, &db, now, 20, 0, 0, "env", 5, 1, 96)
 	filterTest(t, &db, now, 20, 0, 0, "ele", 2, 5, 8)
 	filterTest(t, &db, now, 20, 0, 0, "all", 7, 1, 96)
-	filterTest(t, &db, now, 0, 20210106, 20210107, "all", 7, 1, 2)
+	filterTest(t, &db, now, 0, 20210106, 20210107, "all", 7, 1, 576)
 
 	filterTest(t, &db, time.Date(2021, 1, 8, 0, 0, 0, 0, time.UTC),
 		0, 0, 0, "all", 7, 1, 1)
@@ -106,7 +106,8 @@ func TestFilterSensorData(t *testing.T) {
 
 func filterTest(t *testing.T, db *DB, now time.Time, period int, start int, end int, dataType string,
 	expectedNumberOfSensors int, sensorId int, expectedNumberOfResults int) {
-	result := filterSensorData(db, period, start, end, dataType, now, 0)
+	result := filterSensorData(db, period, start, end, selectDataTier(tierAuto, period, defaultRollupMinPeriod),
+		newSensorFilter(dataType), now)
 	l := len(result)
 	if l != expectedNumberOfSensors {
 		t.Errorf("Wrong result length: %v", l)
@@ -122,3 +123,38 @@ func filterTest(t *testing.T, db *DB, now time.Time, period int, start int, end
 		t.Errorf("Wrong result length for %v sensor: %v", sensorId, l)
 	}
 }
+
+func TestFilterRawSensorData(t *testing.T) {
+	config, err := loadConfiguration("../../test_resources/testConfiguration.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var db DB
+	now := time.Date(2021, 2, 6, 0, 0, 0, 0, time.UTC)
+	err = db.Load(config, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, ok := db.SensorDataMap[20210105]; ok {
+		t.Fatal("20210105 raw data should not be in memory")
+	}
+	rawFilterTest(t, &db, now, 20210105, 20210107, 1, 864)
+	if _, ok := db.rawDataCache.get(20210105); !ok {
+		t.Error("20210105 raw data should be cached")
+	}
+	filterTest(t, &db, now, 0, 20210105, 20210107, "all", 7, 1, 864)
+}
+
+func rawFilterTest(t *testing.T, db *DB, now time.Time, start int, end int, sensorId int, expectedNumberOfResults int) {
+	result := filterSensorData(db, 0, start, end, tierRaw, newSensorFilter("all"), now)
+	d, ok := result[sensorId]
+	if !ok {
+		t.Errorf("%v sensor must be present", sensorId)
+		return
+	}
+	l := d.length()
+	if l != expectedNumberOfResults {
+		t.Errorf("Wrong raw result length for %v sensor: %v", sensorId, l)
+	}
+}
@@ -0,0 +1,149 @@
+package core
+
+import (
+	"fmt"
+	"net/url"
+	"smartHome/src/core/entities"
+	"strconv"
+	"strings"
+)
+
+// sensor_data query filters:
+// data_type=env or all, sensor_id=1,2, location_id=1,2, location_type=int,ext, properties=temp,humi,
+// time_from=HHMM&time_to=HHMM - time of day window, time_from > time_to means window crossing midnight.
+// Time of day window is not applied to daily aggregates.
+type sensorFilter struct {
+	dataType      string
+	sensorIds     map[int]bool
+	locationIds   map[int]bool
+	locationTypes map[string]bool
+	properties    map[string]bool
+	// time of day window HHMMSS, timeTo < 0 - no window
+	timeFrom int
+	timeTo   int
+}
+
+func newSensorFilter(dataType string) *sensorFilter {
+	return &sensorFilter{dataType: dataType, timeTo: -1}
+}
+
+func parseIntSet(values url.Values, name string) (map[int]bool, error) {
+	v := values.Get(name)
+	if len(v) == 0 {
+		return nil, nil
+	}
+	result := make(map[int]bool)
+	for _, s := range strings.Split(v, ",") {
+		i, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %v parameter %v", name, v)
+		}
+		result[i] = true
+	}
+	return result, nil
+}
+
+func parseStringSet(values url.Values, name string) map[string]bool {
+	v := values.Get(name)
+	if len(v) == 0 {
+		return nil
+	}
+	result := make(map[string]bool)
+	for _, s := range strings.Split(v, ",") {
+		result[s] = true
+	}
+	return result
+}
+
+// HHMM -> HHMMSS
+func parseTimeOfDay(values url.Values, name string, seconds int) (int, error) {
+	v := values.Get(name)
+	t, err := strconv.Atoi(v)
+	if err != nil || len(v) != 4 || t/100 > 23 || t%100 > 59 {
+		return 0, fmt.Errorf("invalid %v parameter %v", name, v)
+	}
+	return t*100 + seconds, nil
+}
+
+func parseSensorFilter(values url.Values) (*sensorFilter, error) {
+	filter := newSensorFilter(values.Get("data_type"))
+	var err error
+	filter.sensorIds, err = parseIntSet(values, "sensor_id")
+	if err != nil {
+		return nil, err
+	}
+	filter.locationIds, err = parseIntSet(values, "location_id")
+	if err != nil {
+		return nil, err
+	}
+	filter.locationTypes = parseStringSet(values, "location_type")
+	filter.properties = parseStringSet(values, "properties")
+	if len(filter.dataType) == 0 {
+		if filter.sensorIds == nil && filter.locationIds == nil && filter.locationTypes == nil {
+			return nil, fmt.Errorf("missing or empty datatype parameter")
+		}
+		filter.dataType = "all"
+	}
+	if values.Has("time_from") || values.Has("time_to") {
+		filter.timeFrom, err = parseTimeOfDay(values, "time_from", 0)
+		if err != nil {
+			return nil, err
+		}
+		filter.timeTo, err = parseTimeOfDay(values, "time_to", 59)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return filter, nil
+}
+
+func (f *sensorFilter) matchesSensor(db *DB, sensorId int) bool {
+	if f.sensorIds != nil && !f.sensorIds[sensorId] {
+		return false
+	}
+	if f.dataType != "all" && !isValidDataType(db, sensorId, f.dataType) {
+		return false
+	}
+	if f.locationIds == nil && f.locationTypes == nil {
+		return true
+	}
+	sensor := db.Sensors[sensorId]
+	if f.locationIds != nil && !f.locationIds[sensor.LocationId] {
+		return false
+	}
+	return f.locationTypes == nil || f.locationTypes[db.Locations[sensor.LocationId].LocationType]
+}
+
+func (f *sensorFilter) matchesTime(eventTime int) bool {
+	if f.timeTo < 0 {
+		return true
+	}
+	if f.timeFrom <= f.timeTo {
+		return eventTime >= f.timeFrom && eventTime <= f.timeTo
+	}
+	return eventTime >= f.timeFrom || eventTime <= f.timeTo
+}
+
+// returns data with selected properties only, false when there are no selected properties in data
+func (f *sensorFilter) filterProperties(data entities.SensorData) (entities.SensorData, bool) {
+	if f.properties == nil {
+		return data, true
+	}
+	result := entities.SensorData{EventTime: data.EventTime}
+	if data.Data.Values != nil {
+		result.Data.Values = make(map[string]int)
+		for k, v := range data.Data.Values {
+			if f.properties[k] {
+				result.Data.Values[k] = v
+			}
+		}
+		return result, len(result.Data.Values) > 0
+	}
+	result.Data.Stats = make(map[string]map[string]int)
+	for k, v := range data.Data.Stats {
+		if f.properties[k] {
+			result.Data.Stats[k] = v
+		}
+	}
+	return result, len(result.Data.Stats) > 0
+}
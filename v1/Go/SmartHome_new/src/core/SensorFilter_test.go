@@ -0,0 +1,86 @@
+package core
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func testFilter(t *testing.T, req string) *sensorFilter {
+	values, err := url.ParseQuery(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter, err := parseSensorFilter(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filter
+}
+
+func TestParseSensorFilter(t *testing.T) {
+	for _, req := range []string{"", "data_type=env&sensor_id=a", "data_type=env&time_from=2500&time_to=0100",
+		"data_type=env&time_from=1000"} {
+		values, _ := url.ParseQuery(req)
+		_, err := parseSensorFilter(values)
+		if err == nil {
+			t.Errorf("error expected for %v", req)
+		}
+	}
+	filter := testFilter(t, "sensor_id=1,2&time_from=2200&time_to=0600")
+	if filter.dataType != "all" || len(filter.sensorIds) != 2 {
+		t.Fatal("wrong filter")
+	}
+	if !filter.matchesTime(230000) || !filter.matchesTime(60059) || filter.matchesTime(120000) {
+		t.Fatal("wrong time of day window")
+	}
+}
+
+func TestFilterSensorDataQuery(t *testing.T) {
+	config, err := loadConfiguration("../../test_resources/testConfiguration.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var db DB
+	now := time.Date(2021, 1, 8, 12, 0, 0, 0, time.UTC)
+	err = db.Load(config, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := filterSensorData(&db, 20, 0, 0, tierRaw, testFilter(t, "sensor_id=1&properties=humi"), now)
+	d, ok := result[1]
+	if len(result) != 1 || !ok {
+		t.Fatalf("sensor 1 only expected: %v", len(result))
+	}
+	for _, data := range d.timeData {
+		for _, v := range data {
+			if len(v.Data.Values) != 1 || v.Data.Values["humi"] == 0 {
+				t.Fatalf("humi only expected: %v", v.Data.Values)
+			}
+		}
+	}
+
+	result = filterSensorData(&db, 20, 0, 0, tierRaw, testFilter(t, "location_type=ext"), now)
+	for sensorId := range result {
+		if db.Locations[db.Sensors[sensorId].LocationId].LocationType != "ext" {
+			t.Fatalf("wrong sensor %v", sensorId)
+		}
+	}
+	if len(result) == 0 {
+		t.Fatal("ext sensors expected")
+	}
+
+	result = filterSensorData(&db, 20, 0, 0, tierRaw, testFilter(t, "data_type=env&time_from=1700&time_to=1759"), now)
+	d, ok = result[1]
+	if !ok || d.length() != 12 {
+		t.Fatal("wrong result length for time of day window")
+	}
+
+	result = filterSensorData(&db, 0, 20210106, 20210107, tierDay, testFilter(t, "data_type=env&properties=temp"), now)
+	for _, v := range result[1].timeData[20210106] {
+		if len(v.Data.Stats) != 1 || v.Data.Stats["temp"] == nil {
+			t.Fatalf("temp stats only expected: %v", v.Data.Stats)
+		}
+	}
+}
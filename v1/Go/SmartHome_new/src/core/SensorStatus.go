@@ -0,0 +1,234 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"smartHome/src/core/entities"
+	"sort"
+	"sync"
+	"time"
+)
+
+// vbat samples are kept for vbatTrendDays, not more often than once per vbatSampleInterval
+const vbatTrendDays = 7
+const vbatSampleInterval = time.Hour
+
+type vbatSample struct {
+	time  time.Time
+	value float64
+}
+
+type sensorStatus struct {
+	SensorId         int
+	Name             string
+	Location         string
+	DataType         string
+	ExpectedInterval int
+	LastSeen         *time.Time `json:",omitempty"`
+	DeviceTime       *time.Time `json:",omitempty"`
+	Stale            bool
+	Vbat             *float64 `json:",omitempty"`
+	// volts per day
+	VbatTrend *float64 `json:",omitempty"`
+}
+
+type sensorWatchdog struct {
+	db *DB
+	// map sensorId -> latest sample time of stored sensor data
+	lastSeen map[int]time.Time
+	// map sensorId -> vbat samples
+	vbat  map[int][]vbatSample
+	stale map[int]bool
+	// called when sensor becomes stale or reports again
+	onChange func(status sensorStatus)
+	mutex    sync.Mutex
+}
+
+// builds last seen times and vbat samples from raw sensor data in memory
+func newSensorWatchdog(db *DB) *sensorWatchdog {
+	w := sensorWatchdog{
+		db:       db,
+		lastSeen: make(map[int]time.Time),
+		vbat:     make(map[int][]vbatSample),
+		stale:    make(map[int]bool),
+	}
+	var dates []int
+	for date := range db.SensorDataMap {
+		dates = append(dates, date)
+	}
+	sort.Ints(dates)
+	for _, date := range dates {
+		for sensorId, data := range db.SensorDataMap[date] {
+			sorted := make([]entities.SensorData, len(data))
+			copy(sorted, data)
+			sort.Slice(sorted, func(i, j int) bool { return sorted[i].EventTime < sorted[j].EventTime })
+			for _, d := range sorted {
+				w.updateLastSeen(sensorId, date, &d)
+				w.addVbatSample(sensorId, eventTime(date, d.EventTime), d.Data)
+			}
+		}
+	}
+	return &w
+}
+
+// last seen time is the latest sample time, late or fetched old samples don't change it
+func (w *sensorWatchdog) updateLastSeen(sensorId int, date int, data *entities.SensorData) {
+	t := time.Unix(sampleTime(date, data), 0)
+	if t.After(w.lastSeen[sensorId]) {
+		w.lastSeen[sensorId] = t
+	}
+}
+
+func (w *sensorWatchdog) addVbatSample(sensorId int, t time.Time, data entities.PropertyMap) {
+	v, ok := data.Values["vbat"]
+	if !ok {
+		return
+	}
+	samples := w.vbat[sensorId]
+	l := len(samples)
+	if l > 0 && t.Sub(samples[l-1].time) < vbatSampleInterval {
+		return
+	}
+	samples = append(samples, vbatSample{time: t, value: float64(v) / 100})
+	from := t.AddDate(0, 0, -vbatTrendDays)
+	for len(samples) > 0 && samples[0].time.Before(from) {
+		samples = samples[1:]
+	}
+	w.vbat[sensorId] = samples
+}
+
+// DB listener
+func (w *sensorWatchdog) process(sensorId int, date int, data entities.SensorData) {
+	w.mutex.Lock()
+	w.updateLastSeen(sensorId, date, &data)
+	w.addVbatSample(sensorId, eventTime(date, data.EventTime), data.Data)
+	w.mutex.Unlock()
+}
+
+// least squares slope in volts per day
+func vbatTrend(samples []vbatSample) *float64 {
+	n := float64(len(samples))
+	if n < 2 {
+		return nil
+	}
+	var sx, sy, sxx, sxy float64
+	for _, s := range samples {
+		x := s.time.Sub(samples[0].time).Hours() / 24
+		sx += x
+		sy += s.value
+		sxx += x * x
+		sxy += x * s.value
+	}
+	d := n*sxx - sx*sx
+	if d == 0 {
+		return nil
+	}
+	trend := (n*sxy - sx*sy) / d
+	return &trend
+}
+
+func (w *sensorWatchdog) buildStatus(sensor entities.Sensor, locations map[int]entities.Location,
+	now time.Time) sensorStatus {
+	status := sensorStatus{
+		SensorId:         sensor.Id,
+		Name:             sensor.Name,
+		Location:         locations[sensor.LocationId].Name,
+		DataType:         sensor.DataType,
+		ExpectedInterval: sensor.ExpectedInterval,
+	}
+	lastSeen, ok := w.lastSeen[sensor.Id]
+	if ok {
+		status.LastSeen = &lastSeen
+	}
+	if sensor.ExpectedInterval > 0 {
+		status.Stale = !ok || now.Sub(lastSeen) > time.Duration(sensor.ExpectedInterval)*time.Second
+	}
+	deviceTime, ok := getLastDeviceTime(sensor.DeviceId)
+	if ok {
+		t := time.Unix(int64(deviceTime), 0)
+		status.DeviceTime = &t
+	}
+	samples := w.vbat[sensor.Id]
+	if len(samples) > 0 {
+		status.Vbat = &samples[len(samples)-1].value
+		status.VbatTrend = vbatTrend(samples)
+	}
+	return status
+}
+
+// called by TimerTask, reports sensors that changed stale state
+func (w *sensorWatchdog) check(now time.Time) {
+	var changed []sensorStatus
+	sensors, locations := w.db.getMetadata()
+	w.mutex.Lock()
+	for _, sensor := range sensors {
+		if sensor.ExpectedInterval <= 0 {
+			continue
+		}
+		status := w.buildStatus(sensor, locations, now)
+		if status.Stale != w.stale[sensor.Id] {
+			w.stale[sensor.Id] = status.Stale
+			changed = append(changed, status)
+		}
+	}
+	w.mutex.Unlock()
+	for _, status := range changed {
+		if status.Stale {
+			log.Printf("Sensor %v (%v) stopped reporting, last seen %v\n", status.SensorId, status.Name, status.LastSeen)
+		} else {
+			log.Printf("Sensor %v (%v) reports again\n", status.SensorId, status.Name)
+		}
+		if w.onChange != nil {
+			w.onChange(status)
+		}
+	}
+}
+
+func (w *sensorWatchdog) getStatus(staleOnly bool, now time.Time) []sensorStatus {
+	result := []sensorStatus{}
+	sensors, locations := w.db.getMetadata()
+	w.mutex.Lock()
+	for _, sensor := range sensors {
+		status := w.buildStatus(sensor, locations, now)
+		if !staleOnly || status.Stale {
+			result = append(result, status)
+		}
+	}
+	w.mutex.Unlock()
+	sort.Slice(result, func(i, j int) bool { return result[i].SensorId < result[j].SensorId })
+	return result
+}
+
+func staleSensorEvent(status sensorStatus) alertEvent {
+	event := alertEvent{
+		Rule:      "stale sensor",
+		SensorId:  status.SensorId,
+		Sensor:    status.Name,
+		Location:  status.Location,
+		Active:    status.Stale,
+		EventTime: time.Now(),
+	}
+	if status.Stale {
+		event.Message = fmt.Sprintf("ALERT stale sensor: %v %v stopped reporting", status.Location, status.Name)
+	} else {
+		event.Message = fmt.Sprintf("cleared stale sensor: %v %v reports again", status.Location, status.Name)
+	}
+	return event
+}
+
+func SensorStatusHandler(server *Server, w *bytes.Buffer, req string) {
+	values, err := url.ParseQuery(req)
+	if err != nil {
+		w.Write([]byte("400 Bad request: query parsing error"))
+		return
+	}
+	data, err := json.Marshal(server.watchdog.getStatus(values.Get("stale") == "true", time.Now()))
+	if err != nil {
+		w.Write([]byte(fmt.Sprintf("500 json.Marshal error: %v", err)))
+		return
+	}
+	w.Write(data)
+}
@@ -0,0 +1,83 @@
+package core
+
+import (
+	"smartHome/src/core/entities"
+	"testing"
+	"time"
+)
+
+func TestSensorWatchdog(t *testing.T) {
+	db := DB{
+		Sensors: map[int]entities.Sensor{
+			1: {Id: 1, Name: "cabinet_ext", DataType: "env", LocationId: 1, ExpectedInterval: 600},
+			2: {Id: 2, Name: "pump", DataType: "wat", LocationId: 1},
+		},
+		Locations: map[int]entities.Location{1: {Id: 1, Name: "loc1"}},
+		SensorDataMap: map[int]map[int][]entities.SensorData{
+			20210107: {
+				1: {
+					{EventTime: 120000, Data: entities.PropertyMap{Values: map[string]int{"vbat": 300}}},
+					{EventTime: 100000, Data: entities.PropertyMap{Values: map[string]int{"vbat": 310}}},
+				},
+			},
+			20210108: {
+				1: {{EventTime: 100000, Data: entities.PropertyMap{Values: map[string]int{"vbat": 290}}}},
+			},
+		},
+	}
+	w := newSensorWatchdog(&db)
+	var changes []sensorStatus
+	w.onChange = func(status sensorStatus) { changes = append(changes, status) }
+
+	lastSeen := time.Date(2021, 1, 8, 10, 0, 0, 0, time.Local)
+	w.check(lastSeen.Add(5 * time.Minute))
+	if len(changes) != 0 {
+		t.Fatal("sensor should not be stale")
+	}
+	w.check(lastSeen.Add(11 * time.Minute))
+	if len(changes) != 1 || !changes[0].Stale || changes[0].SensorId != 1 {
+		t.Fatalf("stale sensor expected: %v", changes)
+	}
+	w.check(lastSeen.Add(12 * time.Minute))
+	if len(changes) != 1 {
+		t.Fatal("stale state should be reported once")
+	}
+
+	status := w.getStatus(true, lastSeen.Add(12*time.Minute))
+	if len(status) != 1 || status[0].SensorId != 1 || !status[0].LastSeen.Equal(lastSeen) {
+		t.Fatalf("wrong status: %v", status)
+	}
+	if status[0].Vbat == nil || *status[0].Vbat != 2.9 || status[0].VbatTrend == nil || *status[0].VbatTrend >= 0 {
+		t.Fatal("falling vbat trend expected")
+	}
+	if len(w.getStatus(false, lastSeen)) != 2 {
+		t.Fatal("all sensors expected")
+	}
+
+	w.process(1, 20210108, entities.SensorData{EventTime: 101500})
+	w.process(1, 20210107, entities.SensorData{EventTime: 130000})
+	w.check(lastSeen.Add(20 * time.Minute))
+	if len(changes) != 2 || changes[1].Stale {
+		t.Fatalf("recovered sensor expected: %v", changes)
+	}
+	status = w.getStatus(false, lastSeen.Add(20*time.Minute))
+	if !status[0].LastSeen.Equal(lastSeen.Add(15 * time.Minute)) {
+		t.Fatalf("last seen should be the latest sample time: %v", status[0].LastSeen)
+	}
+}
+
+func TestVbatTrend(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	samples := []vbatSample{
+		{time: start, value: 3},
+		{time: start.Add(24 * time.Hour), value: 2.9},
+		{time: start.Add(48 * time.Hour), value: 2.8},
+	}
+	trend := vbatTrend(samples)
+	if trend == nil || *trend > -0.099 || *trend < -0.101 {
+		t.Fatalf("wrong trend: %v", trend)
+	}
+	if vbatTrend(samples[:1]) != nil {
+		t.Fatal("trend requires two samples")
+	}
+}
@@ -2,24 +2,33 @@ package core
 
 import (
 	"bytes"
-	"encoding/binary"
 	"fmt"
 	"log"
 	"net"
+	"nonce"
 	"os"
+	"smartHome/src/core/entities"
 	"strings"
 	"sync"
-	"time"
 )
 
 type Server struct {
 	key              []byte
 	deviceKey        []byte
+	adminKey         []byte
 	conn             *net.UDPConn
 	compressionType  int
 	db               *DB
 	config           *configuration
-	fetcherTimestamp map[string]int64
+	fetcher          *fetcher
+	chunkedResponses *chunkedResponseCache
+	chunkSize        int
+	nonces           *nonce.Cache
+	subscriptions    *subscriptionManager
+	alerts           *alertEngine
+	watchdog         *sensorWatchdog
+	metrics          *serverMetrics
+	mqtt             *mqttBridge
 	mutex            sync.Mutex
 }
 
@@ -37,6 +46,14 @@ func ServerStart(_compressionType int, db *DB, config *configuration) error {
 		}
 	}
 
+	var adminKey []byte
+	if len(config.AdminKeyFileName) > 0 {
+		adminKey, err = os.ReadFile(config.AdminKeyFileName)
+		if err != nil {
+			return err
+		}
+	}
+
 	var fetchKey []byte
 	if config.FetchConfiguration.Interval > 0 {
 		fetchKey, err = os.ReadFile(config.FetchConfiguration.KeyFileName)
@@ -60,11 +77,52 @@ func ServerStart(_compressionType int, db *DB, config *configuration) error {
 	server := Server{
 		key:              key,
 		deviceKey:        deviceKey,
+		adminKey:         adminKey,
 		conn:             conn,
 		compressionType:  _compressionType,
 		db:               db,
 		config:           config,
-		fetcherTimestamp: make(map[string]int64),
+		chunkedResponses: newChunkedResponseCache(),
+		chunkSize:        defaultChunkSize,
+		nonces:           nonce.NewCache(config.NonceWindow),
+		subscriptions:    newSubscriptionManager(),
+		watchdog:         newSensorWatchdog(db),
+	}
+
+	db.addListener(func(sensorId int, date int, data entities.SensorData) {
+		pushSensorData(&server, sensorId, date, data)
+	})
+
+	if len(config.AlertsFileName) > 0 {
+		alertConfig, err := loadAlertConfiguration(config.AlertsFileName)
+		if err != nil {
+			return err
+		}
+		server.alerts, err = newAlertEngine(alertConfig, db)
+		if err != nil {
+			return err
+		}
+		db.addListener(server.alerts.process)
+		server.watchdog.onChange = func(status sensorStatus) {
+			server.alerts.notify(server.alerts.staleNotifiers, staleSensorEvent(status))
+		}
+	}
+	db.addListener(server.watchdog.process)
+
+	// listeners are registered before servers calling saveSensorData are started
+	if config.MetricsPortNumber > 0 {
+		server.metrics = newServerMetrics(db)
+		db.addListener(server.metrics.process)
+		err := metricsServerStart(&server)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(config.Mqtt.Address) > 0 {
+		server.mqtt = newMqttBridge(db, &config.Mqtt)
+		db.addListener(server.mqtt.process)
+		server.mqtt.start()
 	}
 
 	fmt.Printf("Server started on port %d\n", config.PortNumber)
@@ -76,11 +134,22 @@ func ServerStart(_compressionType int, db *DB, config *configuration) error {
 		}
 	}
 
+	if config.HttpPortNumber > 0 {
+		err := httpServerStart(&server)
+		if err != nil {
+			return err
+		}
+	}
+
 	if config.FetchConfiguration.Interval > 0 {
-		go fetcherInit(&server, fetchKey)
+		server.fetcher, err = newFetcher(fetchKey, &config.FetchConfiguration, config.DataFolder)
+		if err != nil {
+			return err
+		}
+		server.fetcher.start(&server)
 	}
 
-	go TimerTask(&server, fetchKey)
+	go TimerTask(&server)
 
 	buffer := make([]byte, 10000)
 	for {
@@ -90,7 +159,7 @@ func ServerStart(_compressionType int, db *DB, config *configuration) error {
 		if err != nil {
 			return err
 		}
-		go handle(&server, addr, buffer[:n])
+		go handle(&server, addr, append([]byte(nil), buffer[:n]...))
 	}
 }
 
@@ -108,40 +177,81 @@ func logRequestBody(requestBody string) {
 
 func handle(server *Server, addr net.Addr, data []byte) {
 	logRequest(addr)
-	if tryLoadSensorData(server, data, server.config.TimeOffset, false) {
+	if tryLoadSensorData(server, data, false) {
 		return
 	}
-	decodedData, err := AesDecode(data, server.key, CompressNone, func(nonce []byte) error {
-		timePart := binary.LittleEndian.Uint64(nonce[len(nonce)-8:]) >> 16
-		millis := uint64(time.Now().UnixNano() / 1000000)
-		if (timePart >= millis && (timePart-millis < 60000)) ||
-			(timePart < millis && (millis-timePart < 60000)) { // 60 seconds
-			return nil
-		}
-		return fmt.Errorf("incorrect nonce")
-	})
+	var nonce []byte
+	checkNonce := func(n []byte) error {
+		nonce = n
+		return server.nonces.CheckTime(n)
+	}
+	decodedData, err := AesDecode(data, server.key, CompressNone, checkNonce)
+	// admin commands are encrypted with the admin key when it is set
+	admin := false
+	if err != nil && len(server.adminKey) > 0 {
+		decodedData, err = AesDecode(data, server.adminKey, CompressNone, checkNonce)
+		admin = err == nil
+	}
+	if err == nil {
+		err = server.nonces.Add(nonce)
+	}
 	if err != nil {
+		server.metrics.addDecodeFailure()
 		logError(err.Error())
 		return
 	}
 	var writer bytes.Buffer
 	command := string(decodedData)
 	logRequestBody(command)
+	server.metrics.addRequest(requestName(command))
+	if strings.HasPrefix(command, "RESEND ") {
+		resendChunks(server, addr, command[7:])
+		return
+	}
+	chunked := strings.HasPrefix(command, "CHUNKED ")
+	if chunked {
+		command = command[8:]
+	}
 	var errorMessage string
 	if strings.HasPrefix(command, "GET ") {
 		command = command[4:]
 		if strings.HasPrefix(command, "/sensor_data?") {
 			SensorDataHandler(server, &writer, command[13:])
+		} else if command == "/sensor_status" || strings.HasPrefix(command, "/sensor_status?") {
+			SensorStatusHandler(server, &writer, strings.TrimPrefix(command[14:], "?"))
+		} else if strings.HasPrefix(command, "/totals?") {
+			TotalsHandler(server, &writer, command[8:])
+		} else if command == "/fetcher_status" {
+			FetcherStatusHandler(server, &writer)
+		} else if command == "/alerts" {
+			AlertsHandler(server, &writer)
 		} else {
 			errorMessage = "Invalid GET operation"
 		}
+	} else if command == "RELOAD" {
+		ReloadHandler(server, &writer, admin)
+	} else if strings.HasPrefix(command, "POST ") || strings.HasPrefix(command, "PUT ") ||
+		strings.HasPrefix(command, "DELETE ") {
+		AdminHandler(server, &writer, command, admin)
+	} else if strings.HasPrefix(command, "SUBSCRIBE ") {
+		SubscribeHandler(server, addr, &writer, command[10:])
+	} else if strings.HasPrefix(command, "UNSUBSCRIBE ") {
+		UnsubscribeHandler(server, &writer, command[12:])
 	} else {
-		errorMessage = fmt.Sprintf("Invalid method string: %v", command[:7])
+		method := command
+		if len(method) > 7 {
+			method = method[:7]
+		}
+		errorMessage = fmt.Sprintf("Invalid method string: %v", method)
 	}
 	if len(errorMessage) > 0 {
 		logError(errorMessage)
 		writer.Write([]byte(errorMessage))
 	}
+	if chunked {
+		sendChunkedResponse(server, addr, writer.Bytes())
+		return
+	}
 	encodedData, err := AesEncode(writer.Bytes(), server.key, server.compressionType, nil)
 	if err != nil {
 		logError(err.Error())
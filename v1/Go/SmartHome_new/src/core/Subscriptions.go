@@ -0,0 +1,214 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"smartHome/src/core/entities"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Push subscriptions.
+// "SUBSCRIBE data_type=env,ele&sensor_id=1,2&lease=600" registers a subscription for the sender address,
+// "SUBSCRIBE id=5&lease=600" renews it, "UNSUBSCRIBE 5" removes it.
+// Without data_type and sensor_id all sensors are matched.
+// Every stored value of a matching sensor is pushed to the subscriber in sensor_data response format.
+
+const defaultSubscriptionLease = 300
+const maxSubscriptionLease = 3600
+
+type subscription struct {
+	id        int
+	addr      net.Addr
+	dataTypes map[string]bool
+	sensorIds map[int]bool
+	expires   time.Time
+}
+
+type subscriptionResponse struct {
+	Id    int
+	Lease int
+}
+
+type subscriptionManager struct {
+	subscriptions map[int]*subscription
+	lastId        int
+	mutex         sync.Mutex
+}
+
+func newSubscriptionManager() *subscriptionManager {
+	return &subscriptionManager{subscriptions: make(map[int]*subscription)}
+}
+
+func (s *subscription) matches(sensorId int, dataType string) bool {
+	if len(s.dataTypes) == 0 && len(s.sensorIds) == 0 {
+		return true
+	}
+	return s.dataTypes[dataType] || s.sensorIds[sensorId]
+}
+
+func parseLease(values url.Values) (int, error) {
+	leases := values.Get("lease")
+	if len(leases) == 0 {
+		return defaultSubscriptionLease, nil
+	}
+	lease, err := strconv.Atoi(leases)
+	if err != nil || lease <= 0 {
+		return 0, fmt.Errorf("invalid lease parameter %v", leases)
+	}
+	if lease > maxSubscriptionLease {
+		lease = maxSubscriptionLease
+	}
+	return lease, nil
+}
+
+func (m *subscriptionManager) subscribe(addr net.Addr, req string, now time.Time) (*subscriptionResponse, error) {
+	values, err := url.ParseQuery(req)
+	if err != nil {
+		return nil, fmt.Errorf("query parsing error")
+	}
+	lease, err := parseLease(values)
+	if err != nil {
+		return nil, err
+	}
+	expires := now.Add(time.Duration(lease) * time.Second)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.removeExpired(now)
+
+	ids := values.Get("id")
+	if len(ids) > 0 {
+		id, err := strconv.Atoi(ids)
+		if err != nil {
+			return nil, fmt.Errorf("invalid id parameter %v", ids)
+		}
+		s, ok := m.subscriptions[id]
+		if !ok {
+			return nil, fmt.Errorf("unknown or expired subscription %v", id)
+		}
+		s.addr = addr
+		s.expires = expires
+		return &subscriptionResponse{Id: id, Lease: lease}, nil
+	}
+
+	s := subscription{
+		addr:      addr,
+		dataTypes: make(map[string]bool),
+		sensorIds: make(map[int]bool),
+		expires:   expires,
+	}
+	dataTypes := values.Get("data_type")
+	if len(dataTypes) > 0 {
+		for _, dataType := range strings.Split(dataTypes, ",") {
+			s.dataTypes[dataType] = true
+		}
+	}
+	sensorIds := values.Get("sensor_id")
+	if len(sensorIds) > 0 {
+		for _, v := range strings.Split(sensorIds, ",") {
+			sensorId, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid sensor_id parameter %v", sensorIds)
+			}
+			s.sensorIds[sensorId] = true
+		}
+	}
+	m.lastId++
+	s.id = m.lastId
+	m.subscriptions[s.id] = &s
+	return &subscriptionResponse{Id: s.id, Lease: lease}, nil
+}
+
+func (m *subscriptionManager) unsubscribe(req string) error {
+	id, err := strconv.Atoi(req)
+	if err != nil {
+		return fmt.Errorf("invalid subscription id %v", req)
+	}
+	m.mutex.Lock()
+	delete(m.subscriptions, id)
+	m.mutex.Unlock()
+	return nil
+}
+
+func (m *subscriptionManager) removeExpired(now time.Time) {
+	for id, s := range m.subscriptions {
+		if now.After(s.expires) {
+			log.Printf("Subscription %v expired\n", id)
+			delete(m.subscriptions, id)
+		}
+	}
+}
+
+// returns addresses of subscribers for the sensor
+func (m *subscriptionManager) subscribers(sensorId int, dataType string, now time.Time) []net.Addr {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.removeExpired(now)
+	var result []net.Addr
+	for _, s := range m.subscriptions {
+		if s.matches(sensorId, dataType) {
+			result = append(result, s.addr)
+		}
+	}
+	return result
+}
+
+func SubscribeHandler(server *Server, addr net.Addr, w *bytes.Buffer, req string) {
+	response, err := server.subscriptions.subscribe(addr, req, time.Now())
+	if err != nil {
+		w.Write([]byte("400 Bad request: " + err.Error()))
+		return
+	}
+	data, err := json.Marshal(response)
+	if err != nil {
+		w.Write([]byte(fmt.Sprintf("500 json.Marshal error: %v", err)))
+		return
+	}
+	w.Write(data)
+}
+
+func UnsubscribeHandler(server *Server, w *bytes.Buffer, req string) {
+	err := server.subscriptions.unsubscribe(req)
+	if err != nil {
+		w.Write([]byte("400 Bad request: " + err.Error()))
+		return
+	}
+	w.Write([]byte("Ok"))
+}
+
+func buildPushMessage(db *DB, sensorId int, date int, data entities.SensorData) ([]byte, error) {
+	out := MakeOutSensorData(db, sensorId)
+	out.TimeData = []SensorTimeData{buildSensorTimeData(date, []entities.SensorData{data})}
+	return json.Marshal([]*OutSensorData{out})
+}
+
+// DB listener, pushes stored value to subscribers
+func pushSensorData(server *Server, sensorId int, date int, data entities.SensorData) {
+	sensors, _ := server.db.getMetadata()
+	addresses := server.subscriptions.subscribers(sensorId, sensors[sensorId].DataType, time.Now())
+	if len(addresses) == 0 {
+		return
+	}
+	server.db.mutex.RLock()
+	message, err := buildPushMessage(server.db, sensorId, date, data)
+	server.db.mutex.RUnlock()
+	if err != nil {
+		logError(err.Error())
+		return
+	}
+	encodedData, err := AesEncode(message, server.key, server.compressionType, nil)
+	if err != nil {
+		logError(err.Error())
+		return
+	}
+	for _, addr := range addresses {
+		_, _ = server.conn.WriteTo(encodedData, addr)
+	}
+}
@@ -0,0 +1,97 @@
+package core
+
+import (
+	"net"
+	"smartHome/src/core/entities"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSubscriptionLease(t *testing.T) {
+	m := newSubscriptionManager()
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1}
+	now := time.Now()
+	r, err := m.subscribe(addr, "data_type=env&sensor_id=5&lease=10", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Lease != 10 {
+		t.Fatalf("wrong lease: %v", r.Lease)
+	}
+	if len(m.subscribers(1, "env", now)) != 1 {
+		t.Fatal("env sensor should match")
+	}
+	if len(m.subscribers(5, "ele", now)) != 1 {
+		t.Fatal("sensor 5 should match")
+	}
+	if len(m.subscribers(6, "ele", now)) != 0 {
+		t.Fatal("sensor 6 should not match")
+	}
+	_, err = m.subscribe(addr, "id=1&lease=100000", now.Add(5*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.subscribers(1, "env", now.Add(20*time.Second))) != 1 {
+		t.Fatal("renewed subscription should be active")
+	}
+	if len(m.subscribers(1, "env", now.Add(maxSubscriptionLease*time.Second+time.Minute))) != 0 {
+		t.Fatal("subscription should expire")
+	}
+	_, err = m.subscribe(addr, "id=1", now)
+	if err == nil {
+		t.Fatal("expired subscription renewal should fail")
+	}
+	_, err = m.subscribe(addr, "lease=abc", now)
+	if err == nil {
+		t.Fatal("invalid lease should be rejected")
+	}
+}
+
+func TestSubscriptionPush(t *testing.T) {
+	server := startTestUdpServer(t)
+	server.db = &DB{
+		Sensors:       map[int]entities.Sensor{1: {Id: 1, DataType: "env", LocationId: 1}},
+		Locations:     map[int]entities.Location{1: {Id: 1, Name: "loc1"}},
+		SensorDataMap: make(map[int]map[int][]entities.SensorData),
+		DataToBeSaved: make(map[int][]int),
+	}
+	server.subscriptions = newSubscriptionManager()
+	server.db.addListener(func(sensorId int, date int, data entities.SensorData) {
+		pushSensorData(server, sensorId, date, data)
+	})
+
+	client, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	_, err = server.subscriptions.subscribe(client.LocalAddr(), "data_type=env", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = server.db.saveSensorData(1, decodedMessage{
+		MessageTime: time.Date(2021, 1, 7, 10, 0, 0, 0, time.UTC),
+		Message:     entities.PropertyMap{Values: map[string]int{"temp": 2150}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := make([]byte, 65507)
+	_ = client.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := client.Read(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := AesDecode(p[:n], testKey, CompressGzip, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := string(data)
+	if !strings.Contains(s, "\"locationName\":\"loc1\"") || !strings.Contains(s, "\"temp\":21.5") ||
+		!strings.Contains(s, "\"date\":20210107") {
+		t.Fatalf("wrong push message: %v", s)
+	}
+}
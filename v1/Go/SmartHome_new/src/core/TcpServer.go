@@ -40,7 +40,7 @@ func handleTcp(conn net.Conn, server *Server) {
 	if err != nil {
 		return
 	}
-	if !tryLoadSensorData(server, buf[:reqLen], server.config.TimeOffset, true) {
+	if !tryLoadSensorData(server, buf[:reqLen], true) {
 		log.Println("Invalid sensor data")
 	}
 }
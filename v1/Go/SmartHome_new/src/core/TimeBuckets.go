@@ -0,0 +1,169 @@
+package core
+
+import (
+	"fmt"
+	"smartHome/src/core/entities"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Downsampling by aligned time buckets (bucket=5m|1h|1d query parameter).
+// Every bucket contains Min/Max/Avg/Last stats per property, EventTime is the bucket start time.
+// A record with Gap flag is added at the start of every run of empty buckets.
+
+// returns bucket length in seconds, bucket length should divide a day
+func parseBucket(bucket string) (int, error) {
+	l := len(bucket)
+	if l < 2 {
+		return 0, fmt.Errorf("invalid bucket parameter %v", bucket)
+	}
+	n, err := strconv.Atoi(bucket[:l-1])
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid bucket parameter %v", bucket)
+	}
+	switch bucket[l-1] {
+	case 'm':
+		n *= 60
+	case 'h':
+		n *= 3600
+	case 'd':
+		n *= 86400
+	default:
+		return 0, fmt.Errorf("invalid bucket parameter %v", bucket)
+	}
+	if 86400%n != 0 {
+		return 0, fmt.Errorf("bucket length should divide a day: %v", bucket)
+	}
+	return n, nil
+}
+
+type bucketStats struct {
+	min  int
+	max  int
+	sum  int
+	cnt  int
+	last int
+}
+
+type timeBucket struct {
+	date  int
+	start int
+	stats map[string]*bucketStats
+}
+
+func toSeconds(eventTime int) int {
+	return eventTime/10000*3600 + (eventTime/100)%100*60 + eventTime%100
+}
+
+func fromSeconds(seconds int) int {
+	return seconds/3600*10000 + (seconds/60)%60*100 + seconds%60
+}
+
+func (b *timeBucket) add(property string, min int, max int, avg int, cnt int) {
+	s, ok := b.stats[property]
+	if !ok {
+		b.stats[property] = &bucketStats{min: min, max: max, sum: avg * cnt, cnt: cnt, last: avg}
+		return
+	}
+	if min < s.min {
+		s.min = min
+	}
+	if max > s.max {
+		s.max = max
+	}
+	s.sum += avg * cnt
+	s.cnt += cnt
+	s.last = avg
+}
+
+func (b *timeBucket) addData(data entities.PropertyMap) {
+	for k, v := range data.Values {
+		b.add(k, v, v, v, 1)
+	}
+	for k, v := range data.Stats {
+		cnt := v["Cnt"]
+		if cnt <= 0 {
+			cnt = 1
+		}
+		b.add(k, v["Min"], v["Max"], v["Avg"], cnt)
+	}
+}
+
+func (b *timeBucket) build() entities.OutSensorData {
+	stats := make(map[string]map[string]int)
+	for k, s := range b.stats {
+		stats[k] = map[string]int{"Min": s.min, "Max": s.max, "Avg": s.sum / s.cnt, "Last": s.last}
+	}
+	return entities.OutSensorData{EventTime: fromSeconds(b.start), Data: entities.OutPropertyMap{Stats: stats}}
+}
+
+// bucket start time, zone aware, so buckets around daylight saving time changes are adjacent
+func (b *timeBucket) startTime() time.Time {
+	return eventTime(b.date, fromSeconds(b.start))
+}
+
+// start time of the next bucket, used to find gaps between buckets
+func (b *timeBucket) endTime(bucket int) time.Time {
+	return eventTime(b.date, fromSeconds(b.start+bucket))
+}
+
+func (sd *OutSensorData) buildBuckets(bucket int) []*timeBucket {
+	var dates []int
+	for date := range sd.timeData {
+		dates = append(dates, date)
+	}
+	sort.Ints(dates)
+	var result []*timeBucket
+	for _, date := range dates {
+		data := make([]entities.SensorData, len(sd.timeData[date]))
+		copy(data, sd.timeData[date])
+		sort.SliceStable(data, func(i, j int) bool { return data[i].EventTime < data[j].EventTime })
+		var current *timeBucket
+		for _, d := range data {
+			start := toSeconds(d.EventTime) / bucket * bucket
+			if current == nil || current.start != start {
+				current = &timeBucket{date: date, start: start, stats: make(map[string]*bucketStats)}
+				result = append(result, current)
+			}
+			current.addData(d.Data)
+		}
+	}
+	return result
+}
+
+func (sd *OutSensorData) buildBucketTimeData(bucket int) []SensorTimeData {
+	result := []SensorTimeData{}
+	var prev *timeBucket
+	addRecord := func(date int, record entities.OutSensorData) {
+		l := len(result)
+		if l == 0 || result[l-1].Date != date {
+			result = append(result, SensorTimeData{Date: date})
+			l++
+		}
+		result[l-1].Data = append(result[l-1].Data, record)
+	}
+	for _, b := range sd.buildBuckets(bucket) {
+		if prev != nil {
+			gapStart := prev.endTime(bucket)
+			if b.startTime().After(gapStart) {
+				gapDate, gapTime := toDateTime(gapStart)
+				addRecord(gapDate, entities.OutSensorData{EventTime: gapTime, Gap: true})
+			}
+		}
+		addRecord(b.date, b.build())
+		prev = b
+	}
+	return result
+}
+
+func (sd *OutSensorData) aggregateBuckets(bucket int, config *configuration) OutSensorData {
+	return OutSensorData{
+		LocationName: sd.LocationName,
+		LocationType: sd.LocationType,
+		DataType:     sd.DataType,
+		Total:        sd.calculateTotal(config.TotalCalculation),
+		TimeData:     sd.buildBucketTimeData(bucket),
+		timeData:     nil,
+	}
+}
@@ -0,0 +1,85 @@
+package core
+
+import (
+	"encoding/json"
+	"smartHome/src/core/entities"
+	"strings"
+	"testing"
+)
+
+func TestParseBucket(t *testing.T) {
+	for bucket, expected := range map[string]int{"5m": 300, "1h": 3600, "1d": 86400} {
+		v, err := parseBucket(bucket)
+		if err != nil || v != expected {
+			t.Errorf("wrong bucket value for %v: %v", bucket, v)
+		}
+	}
+	for _, bucket := range []string{"", "h", "7m", "2d", "5s", "-1h"} {
+		_, err := parseBucket(bucket)
+		if err == nil {
+			t.Errorf("error expected for %v", bucket)
+		}
+	}
+}
+
+func testValue(eventTime int, temp int) entities.SensorData {
+	return entities.SensorData{EventTime: eventTime, Data: entities.PropertyMap{Values: map[string]int{"temp": temp}}}
+}
+
+func TestBuildBucketTimeData(t *testing.T) {
+	sd := OutSensorData{timeData: map[int][]entities.SensorData{
+		20210107: {testValue(100500, 100), testValue(100000, 300), testValue(103000, 200), testValue(230000, 500)},
+		20210108: {testValue(1000, 700)},
+	}}
+	result := sd.buildBucketTimeData(3600)
+	if len(result) != 2 || result[0].Date != 20210107 || result[1].Date != 20210108 {
+		t.Fatalf("wrong result dates: %v", result)
+	}
+	day := result[0].Data
+	if len(day) != 3 || day[0].EventTime != 100000 || !day[1].Gap || day[1].EventTime != 110000 || day[2].EventTime != 230000 {
+		t.Fatalf("wrong buckets: %v", day)
+	}
+	stats := day[0].Data.Stats["temp"]
+	if stats["Min"] != 100 || stats["Max"] != 300 || stats["Avg"] != 200 || stats["Last"] != 200 {
+		t.Fatalf("wrong bucket stats: %v", stats)
+	}
+	// 23:00 and 00:00 buckets are adjacent
+	if len(result[1].Data) != 1 || result[1].Data[0].Gap {
+		t.Fatalf("no gap expected: %v", result[1].Data)
+	}
+	data, err := json.Marshal(result[0].Data[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "\"Gap\":true") {
+		t.Fatalf("wrong gap marker: %v", string(data))
+	}
+}
+
+func TestBuildBucketTimeDataDaylightSavingTimeChange(t *testing.T) {
+	location, err := loadTimeZone("Europe/Kiev", 0)
+	if err != nil {
+		t.Skip(err)
+	}
+	saved := timeZone
+	timeZone = location
+	defer func() { timeZone = saved }()
+
+	// clock is moved from 03:00 to 04:00, 02:55 and 04:00 buckets are adjacent
+	sd := OutSensorData{timeData: map[int][]entities.SensorData{
+		20210328: {testValue(25500, 100), testValue(40000, 200), testValue(41500, 300)},
+	}}
+	day := sd.buildBucketTimeData(300)[0].Data
+	if len(day) != 4 || day[0].Gap || day[1].Gap || !day[2].Gap || day[2].EventTime != 40500 {
+		t.Fatalf("wrong buckets: %v", day)
+	}
+
+	// clock is moved from 04:00 to 03:00, there is a one hour gap between 02:00 and 04:00 buckets
+	sd = OutSensorData{timeData: map[int][]entities.SensorData{
+		20211031: {testValue(20000, 100), testValue(40000, 200)},
+	}}
+	day = sd.buildBucketTimeData(3600)[0].Data
+	if len(day) != 3 || !day[1].Gap || day[1].EventTime != 30000 {
+		t.Fatalf("wrong buckets: %v", day)
+	}
+}
@@ -0,0 +1,84 @@
+package core
+
+import (
+	"smartHome/src/core/entities"
+	"testing"
+	"time"
+)
+
+func TestLoadTimeZone(t *testing.T) {
+	location, err := loadTimeZone("", 0)
+	if err != nil || location != time.Local {
+		t.Fatal("local time zone expected")
+	}
+	_, err = loadTimeZone("", 2)
+	if err == nil {
+		t.Fatal("TimeOffset error expected")
+	}
+	location, err = loadTimeZone("UTC", 2)
+	if err != nil || location != time.UTC {
+		t.Fatal("TimeZone should be used")
+	}
+	_, err = loadTimeZone("Unknown/Zone", 0)
+	if err == nil {
+		t.Fatal("error expected")
+	}
+}
+
+func TestDaylightSavingTimeChange(t *testing.T) {
+	location, err := loadTimeZone("Europe/Kiev", 0)
+	if err != nil {
+		t.Skip(err)
+	}
+	saved := timeZone
+	timeZone = location
+	defer func() { timeZone = saved }()
+
+	db := DB{
+		Sensors:       map[int]entities.Sensor{1: {Id: 1, DataType: "env"}},
+		SensorDataMap: make(map[int]map[int][]entities.SensorData),
+		DataToBeSaved: make(map[int][]int),
+	}
+	db.buildDataTypeMap()
+	// 03:30 local time before and after the clock change
+	for i, messageTime := range []time.Time{time.Date(2021, 10, 31, 0, 30, 0, 0, time.UTC),
+		time.Date(2021, 10, 31, 1, 30, 0, 0, time.UTC)} {
+		err = db.saveSensorData(1, decodedMessage{MessageTime: messageTime,
+			Message: entities.PropertyMap{Values: map[string]int{"temp": i}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	data := db.SensorDataMap[20211031][1]
+	if len(data) != 2 || data[0].EventTime != 33000 || data[1].EventTime != 33000 {
+		t.Fatalf("both values should be stored: %v", data)
+	}
+
+	result := filterSensorData(&db, 1, 0, 0, tierRaw, newSensorFilter("env"), time.Date(2021, 10, 31, 2, 0, 0, 0, time.UTC))
+	d := result[1].timeData[20211031]
+	if len(d) != 1 || d[0].Data.Values["temp"] != 1 {
+		t.Fatalf("value after the clock change expected: %v", d)
+	}
+}
+
+func TestDateAge(t *testing.T) {
+	location, err := loadTimeZone("Europe/Kiev", 0)
+	if err != nil {
+		t.Skip(err)
+	}
+	saved := timeZone
+	timeZone = location
+	defer func() { timeZone = saved }()
+
+	// day of the clock change has 23 hours
+	now := time.Date(2021, 3, 29, 0, 30, 0, 0, location)
+	if age := dateAge(20210328, now); age != 1 {
+		t.Fatalf("wrong age: %v", age)
+	}
+	if age := dateAge(20210329, time.Date(2021, 3, 29, 23, 0, 0, 0, location)); age != 0 {
+		t.Fatalf("wrong age: %v", age)
+	}
+	if age := dateAge(20210101, time.Date(2021, 3, 28, 23, 30, 0, 0, location)); age != 86 {
+		t.Fatalf("wrong age: %v", age)
+	}
+}
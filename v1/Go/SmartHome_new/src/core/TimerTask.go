@@ -8,7 +8,7 @@ import (
 
 var TimerTaskStopChannel = make(chan bool)
 
-func TimerTask(server *Server, fetchKey []byte) {
+func TimerTask(server *Server) {
 	seconds := 0
 	hour := time.Now().Hour()
 	for {
@@ -17,23 +17,32 @@ func TimerTask(server *Server, fetchKey []byte) {
 		select {
 		case _ = <-TimerTaskStopChannel:
 			fmt.Print("Timer stop event. Exiting...")
+			if server.mqtt != nil {
+				server.mqtt.stopBridge()
+			}
+			if server.fetcher != nil {
+				server.fetcher.stopWorkers()
+			}
 			server.db.backupData(server.config, now)
+			server.db.Close()
 			os.Exit(0)
 		default:
 			break
 		}
 		seconds++
-		if server.config.FetchConfiguration.Interval > 0 && (seconds%server.config.FetchConfiguration.Interval == 0) {
-			fetchData(server, fetchKey)
+		if (seconds % 60) == 0 {
+			server.watchdog.check(now)
 		}
 		if (seconds % server.config.BackupInterval) == 0 {
 			server.db.backupData(server.config, now)
+			server.metrics.addBackup(time.Since(now))
 		}
 		hourNow := now.Hour()
 		if hour != hourNow {
 			hour = hourNow
 			if hour == server.config.AggregationHour {
 				server.db.aggregateLastDayData(server.config.TotalCalculation)
+				server.db.applyRetention(server.config, now)
 			}
 		}
 	}
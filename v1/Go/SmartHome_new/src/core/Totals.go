@@ -0,0 +1,407 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"smartHome/src/core/entities"
+	"sort"
+	"strconv"
+)
+
+// Consumption totals (GET /totals command).
+// Total calculation methods (TotalMethods configuration parameter, property -> method):
+//   sum - values are summed, the sum is divided by TotalCalculation divider (default method),
+//   counter - property is a cumulative counter, total is a sum of counter increments, a counter decrease means counter reset,
+//   power - property is a power, total is the power integrated over time in value * hours units,
+//     a value is held until the next value but not longer than maxPowerHoldTime.
+// Every increment is assigned to the tariff window containing its event time, "default" tariff is used otherwise.
+// Dates without raw data in memory use rollup data when it is stored, raw data files otherwise.
+// Date range is limited to maxTotalsDays days.
+
+const (
+	totalSum     = "sum"
+	totalCounter = "counter"
+	totalPower   = "power"
+)
+
+var totalMethods = map[string]bool{totalSum: true, totalCounter: true, totalPower: true}
+
+const defaultTariff = "default"
+
+// seconds
+const maxPowerHoldTime = 900
+
+const maxTotalsDays = 366
+
+// tariff time window, From and To are HHMM, To is not included, From > To means window crossing midnight
+type tariff struct {
+	Name string
+	From int
+	To   int
+}
+
+func validTimeOfDay(t int) bool {
+	return t >= 0 && t/100 <= 23 && t%100 <= 59
+}
+
+func validateTotalsConfiguration(methods map[string]string, tariffs []tariff) error {
+	for property, method := range methods {
+		if !totalMethods[method] {
+			return fmt.Errorf("unknown total calculation method %v for %v", method, property)
+		}
+	}
+	for _, t := range tariffs {
+		if len(t.Name) == 0 || !validTimeOfDay(t.From) || !validTimeOfDay(t.To) || t.From == t.To {
+			return fmt.Errorf("incorrect tariff %v", t.Name)
+		}
+	}
+	return nil
+}
+
+func findTariff(tariffs []tariff, eventTime int) string {
+	hhmm := eventTime / 100
+	for _, t := range tariffs {
+		if t.From < t.To && hhmm >= t.From && hhmm < t.To {
+			return t.Name
+		}
+		if t.From > t.To && (hhmm >= t.From || hhmm < t.To) {
+			return t.Name
+		}
+	}
+	return defaultTariff
+}
+
+type totalsQuery struct {
+	filter *sensorFilter
+	start  int
+	end    int
+	// per month totals when true, per day totals otherwise
+	monthly bool
+}
+
+func parseTotalsQuery(req string) (*totalsQuery, error) {
+	values, err := url.ParseQuery(req)
+	if err != nil {
+		return nil, fmt.Errorf("query parsing error")
+	}
+	if len(values.Get("data_type")) == 0 {
+		values.Set("data_type", "all")
+	}
+	query := totalsQuery{}
+	query.filter, err = parseSensorFilter(values)
+	if err != nil {
+		return nil, err
+	}
+	starts := values.Get("start")
+	ends := values.Get("end")
+	if len(starts) != 8 || len(ends) != 8 {
+		return nil, fmt.Errorf("invalid start or end parameter %v %v", starts, ends)
+	}
+	query.start, err = strconv.Atoi(starts)
+	if err != nil || query.start <= 0 {
+		return nil, fmt.Errorf("invalid start parameter %v", starts)
+	}
+	query.end, err = strconv.Atoi(ends)
+	if err != nil || query.end < query.start {
+		return nil, fmt.Errorf("invalid end parameter %v", ends)
+	}
+	if daysBetween(query.start, query.end) >= maxTotalsDays {
+		return nil, fmt.Errorf("date range is longer than %v days", maxTotalsDays)
+	}
+	switch values.Get("group") {
+	case "", "day":
+	case "month":
+		query.monthly = true
+	default:
+		return nil, fmt.Errorf("invalid group parameter %v", values.Get("group"))
+	}
+	return &query, nil
+}
+
+type totalAccumulator struct {
+	method  string
+	divider int
+	// previous sample, prevTime = 0 - no previous sample
+	prevTime   int64
+	prevValue  int
+	prevPeriod int
+	prevTariff string
+	// period -> tariff -> total, sum method totals are not divided
+	totals map[int]map[string]float64
+}
+
+func (t *totalAccumulator) add(period int, tariffName string, value float64) {
+	m, ok := t.totals[period]
+	if !ok {
+		m = make(map[string]float64)
+		t.totals[period] = m
+	}
+	m[tariffName] += value
+}
+
+func (t *totalAccumulator) addSample(period int, tariffName string, timestamp int64, value int) {
+	switch t.method {
+	case totalCounter:
+		if t.prevTime != 0 {
+			delta := value - t.prevValue
+			if delta < 0 {
+				delta = value
+			}
+			t.add(period, tariffName, float64(delta))
+		}
+	case totalPower:
+		if t.prevTime != 0 {
+			dt := timestamp - t.prevTime
+			if dt > maxPowerHoldTime {
+				dt = maxPowerHoldTime
+			}
+			t.add(t.prevPeriod, t.prevTariff, float64(t.prevValue)*float64(dt)/3600)
+		}
+	default:
+		t.add(period, tariffName, float64(value))
+	}
+	t.prevTime = timestamp
+	t.prevValue = value
+	t.prevPeriod = period
+	t.prevTariff = tariffName
+}
+
+// rollup record stats, EventTime is the interval start
+func (t *totalAccumulator) addStats(period int, tariffName string, timestamp int64, stats map[string]int,
+	rollupMinutes int) {
+	switch t.method {
+	case totalCounter:
+		t.addSample(period, tariffName, timestamp, stats["Min"])
+		t.addSample(period, tariffName, timestamp, stats["Max"])
+	case totalPower:
+		t.add(period, tariffName, float64(stats["Avg"])*float64(rollupMinutes)/60)
+		t.prevTime = 0
+	default:
+		// rollup sum is divided, RawSum is missing for properties without divider
+		sum, ok := stats["RawSum"]
+		if !ok {
+			sum = stats["Sum"] * t.divider
+		}
+		t.add(period, tariffName, float64(sum))
+	}
+}
+
+func (t *totalAccumulator) result(tariffs bool) []periodTotal {
+	var periods []int
+	for period := range t.totals {
+		periods = append(periods, period)
+	}
+	sort.Ints(periods)
+	result := []periodTotal{}
+	for _, period := range periods {
+		pt := periodTotal{Period: period}
+		total := 0.0
+		for name, value := range t.totals[period] {
+			total += value
+			if tariffs {
+				if pt.Tariffs == nil {
+					pt.Tariffs = make(map[string]int)
+				}
+				pt.Tariffs[name] = t.round(value)
+			}
+		}
+		pt.Total = t.round(total)
+		result = append(result, pt)
+	}
+	return result
+}
+
+func (t *totalAccumulator) round(value float64) int {
+	if t.method == totalSum {
+		value /= float64(t.divider)
+	}
+	return int(math.Round(value))
+}
+
+type periodTotal struct {
+	// YYYYMMDD or YYYYMM
+	Period  int            `json:"period"`
+	Total   int            `json:"total"`
+	Tariffs map[string]int `json:"tariffs,omitempty"`
+}
+
+type totalsResult struct {
+	SensorId     int           `json:"sensorId"`
+	LocationName string        `json:"locationName"`
+	LocationType string        `json:"locationType"`
+	DataType     string        `json:"dataType"`
+	Property     string        `json:"property"`
+	Totals       []periodTotal `json:"totals"`
+}
+
+type totalsKey struct {
+	sensorId int
+	property string
+}
+
+type totalsCalculator struct {
+	config       *configuration
+	monthly      bool
+	filter       *sensorFilter
+	accumulators map[totalsKey]*totalAccumulator
+}
+
+// properties having total calculation method or divider
+func totalProperties(config *configuration) map[string]bool {
+	result := make(map[string]bool)
+	for property := range config.TotalCalculation {
+		result[property] = true
+	}
+	for property := range config.TotalMethods {
+		result[property] = true
+	}
+	return result
+}
+
+func (c *totalsCalculator) getAccumulator(sensorId int, property string) *totalAccumulator {
+	key := totalsKey{sensorId: sensorId, property: property}
+	acc, ok := c.accumulators[key]
+	if !ok {
+		method, ok := c.config.TotalMethods[property]
+		if !ok {
+			method = totalSum
+		}
+		divider, ok := c.config.TotalCalculation[property]
+		if !ok || divider <= 0 {
+			divider = 1
+		}
+		acc = &totalAccumulator{method: method, divider: divider, totals: make(map[int]map[string]float64)}
+		c.accumulators[key] = acc
+	}
+	return acc
+}
+
+func (c *totalsCalculator) period(date int) int {
+	if c.monthly {
+		return date / 100
+	}
+	return date
+}
+
+func sampleTime(date int, d *entities.SensorData) int64 {
+	if d.Timestamp != 0 {
+		return d.Timestamp
+	}
+	return eventTime(date, d.EventTime).Unix()
+}
+
+func (c *totalsCalculator) addRawData(date int, sensorId int, data []entities.SensorData, properties map[string]bool) {
+	sorted := make([]entities.SensorData, len(data))
+	copy(sorted, data)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sampleTime(date, &sorted[i]) < sampleTime(date, &sorted[j])
+	})
+	period := c.period(date)
+	for _, d := range sorted {
+		tariffName := findTariff(c.config.Tariffs, d.EventTime)
+		timestamp := sampleTime(date, &d)
+		for property, value := range d.Data.Values {
+			if properties[property] {
+				c.getAccumulator(sensorId, property).addSample(period, tariffName, timestamp, value)
+			}
+		}
+	}
+}
+
+func (c *totalsCalculator) addRollupData(date int, sensorId int, data []entities.SensorData,
+	properties map[string]bool, rollupMinutes int) {
+	period := c.period(date)
+	for _, d := range data {
+		tariffName := findTariff(c.config.Tariffs, d.EventTime)
+		timestamp := eventTime(date, d.EventTime).Unix()
+		for property, stats := range d.Data.Stats {
+			if properties[property] {
+				c.getAccumulator(sensorId, property).addStats(period, tariffName, timestamp, stats, rollupMinutes)
+			}
+		}
+	}
+}
+
+func (c *totalsCalculator) properties() map[string]bool {
+	properties := totalProperties(c.config)
+	if c.filter.properties != nil {
+		for property := range properties {
+			if !c.filter.properties[property] {
+				delete(properties, property)
+			}
+		}
+	}
+	return properties
+}
+
+func calculateTotals(db *DB, config *configuration, query *totalsQuery) []totalsResult {
+	c := totalsCalculator{
+		config:       config,
+		monthly:      query.monthly,
+		filter:       query.filter,
+		accumulators: make(map[totalsKey]*totalAccumulator),
+	}
+	properties := c.properties()
+	days := db.readRawDays(query.start, query.end, true)
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	for date := query.start; date <= query.end; date = nextDate(date) {
+		if _, ok := db.SensorDataMap[date]; !ok {
+			rollup, ok := db.SensorDataRollup[date]
+			if ok {
+				for sensorId, v := range rollup {
+					if c.filter.matchesSensor(db, sensorId) {
+						c.addRollupData(date, sensorId, v, properties, db.rollupMinutes)
+					}
+				}
+				continue
+			}
+		}
+		data := db.rawDayData(date, days)
+		if data != nil {
+			for sensorId, v := range data {
+				if c.filter.matchesSensor(db, sensorId) {
+					c.addRawData(date, sensorId, v, properties)
+				}
+			}
+		}
+	}
+	result := []totalsResult{}
+	for key, acc := range c.accumulators {
+		sensor := db.Sensors[key.sensorId]
+		location := db.Locations[sensor.LocationId]
+		result = append(result, totalsResult{
+			SensorId:     key.sensorId,
+			LocationName: location.Name,
+			LocationType: location.LocationType,
+			DataType:     sensor.DataType,
+			Property:     key.property,
+			Totals:       acc.result(len(config.Tariffs) > 0),
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].SensorId != result[j].SensorId {
+			return result[i].SensorId < result[j].SensorId
+		}
+		return result[i].Property < result[j].Property
+	})
+	return result
+}
+
+func TotalsHandler(server *Server, w *bytes.Buffer, req string) {
+	query, err := parseTotalsQuery(req)
+	if err != nil {
+		w.Write([]byte("400 Bad request: " + err.Error()))
+		return
+	}
+	result := calculateTotals(server.db, server.config, query)
+	data, err := json.Marshal(result)
+	if err != nil {
+		w.Write([]byte(fmt.Sprintf("500 json.Marshal error: %v", err)))
+		return
+	}
+	w.Write(data)
+}
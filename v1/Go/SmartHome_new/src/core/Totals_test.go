@@ -0,0 +1,125 @@
+package core
+
+import (
+	"smartHome/src/core/entities"
+	"testing"
+)
+
+func totalTestData(eventTime int, property string, value int) entities.SensorData {
+	return entities.SensorData{EventTime: eventTime, Data: entities.PropertyMap{Values: map[string]int{property: value}}}
+}
+
+func makeTotalsTestDB() *DB {
+	db := DB{
+		Sensors: map[int]entities.Sensor{
+			1: {Id: 1, DataType: "ele", LocationId: 1},
+			2: {Id: 2, DataType: "wat", LocationId: 1},
+			3: {Id: 3, DataType: "ele", LocationId: 1},
+		},
+		Locations: map[int]entities.Location{1: {Id: 1, Name: "loc1"}},
+		SensorDataMap: map[int]map[int][]entities.SensorData{
+			20210131: {
+				// power, W * 100
+				1: {totalTestData(230000, "pwr", 100000), totalTestData(220000, "pwr", 200000), totalTestData(221000, "pwr", 300000)},
+				// water counter
+				2: {totalTestData(100000, "icc", 1000), totalTestData(110000, "icc", 1500), totalTestData(230000, "icc", 2000)},
+				3: {totalTestData(100000, "cnt", 12), totalTestData(110000, "cnt", 13)},
+			},
+			20210201: {
+				2: {totalTestData(10000, "icc", 2100), totalTestData(20000, "icc", 50)},
+			},
+		},
+		SensorDataRollup: map[int]map[int][]entities.SensorData{
+			20210202: {
+				1: {{EventTime: 120000, Data: entities.PropertyMap{Stats: map[string]map[string]int{"pwr": {"Avg": 60000}}}}},
+				2: {{EventTime: 120000, Data: entities.PropertyMap{Stats: map[string]map[string]int{"icc": {"Min": 100, "Max": 150}}}}},
+				3: {
+					{EventTime: 120000, Data: entities.PropertyMap{Stats: map[string]map[string]int{"cnt": {"Sum": 2, "RawSum": 5}}}},
+					{EventTime: 123000, Data: entities.PropertyMap{Stats: map[string]map[string]int{"cnt": {"Sum": 2, "RawSum": 5}}}},
+				},
+			},
+		},
+		rollupMinutes: 30,
+	}
+	db.buildDataTypeMap()
+	return &db
+}
+
+func findTotals(t *testing.T, results []totalsResult, sensorId int) []periodTotal {
+	for _, r := range results {
+		if r.SensorId == sensorId {
+			return r.Totals
+		}
+	}
+	t.Fatalf("no totals for sensor %v", sensorId)
+	return nil
+}
+
+func TestCalculateTotals(t *testing.T) {
+	db := makeTotalsTestDB()
+	config := configuration{
+		TotalCalculation: map[string]int{"cnt": 2},
+		TotalMethods:     map[string]string{"pwr": totalPower, "icc": totalCounter},
+		Tariffs:          []tariff{{Name: "night", From: 2300, To: 700}},
+	}
+	query, err := parseTotalsQuery("start=20210131&end=20210202")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := calculateTotals(db, &config, query)
+	if len(results) != 3 {
+		t.Fatalf("wrong results: %v", results)
+	}
+
+	// 2000 W for 10 minutes, 3000 W for 15 minutes (hold time limit), 600 W for 30 minutes from rollup
+	pwr := findTotals(t, results, 1)
+	if len(pwr) != 2 || pwr[0].Period != 20210131 || pwr[0].Total != 108333 || pwr[0].Tariffs[defaultTariff] != 108333 ||
+		pwr[1].Total != 30000 {
+		t.Fatalf("wrong power totals: %v", pwr)
+	}
+
+	// counter reset on 20210201, rollup on 20210202
+	icc := findTotals(t, results, 2)
+	if len(icc) != 3 || icc[0].Total != 1000 || icc[0].Tariffs["night"] != 500 || icc[0].Tariffs[defaultTariff] != 500 ||
+		icc[1].Total != 150 || icc[1].Tariffs["night"] != 150 || icc[2].Total != 100 {
+		t.Fatalf("wrong counter totals: %v", icc)
+	}
+
+	// sum divided by divider, undivided rollup sums are used
+	cnt := findTotals(t, results, 3)
+	if len(cnt) != 2 || cnt[0].Total != 13 || cnt[1].Total != 5 {
+		t.Fatalf("wrong sum totals: %v", cnt)
+	}
+
+	query, err = parseTotalsQuery("start=20210131&end=20210202&group=month&sensor_id=2&properties=icc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results = calculateTotals(db, &config, query)
+	if len(results) != 1 {
+		t.Fatalf("wrong results: %v", results)
+	}
+	icc = results[0].Totals
+	if len(icc) != 2 || icc[0].Period != 202101 || icc[0].Total != 1000 || icc[1].Period != 202102 || icc[1].Total != 250 {
+		t.Fatalf("wrong monthly totals: %v", icc)
+	}
+}
+
+func TestParseTotalsQuery(t *testing.T) {
+	for _, req := range []string{"", "start=20210131", "start=20210131&end=20210130", "start=20210131&end=20210201&group=x",
+		"start=20210101&end=20220102"} {
+		_, err := parseTotalsQuery(req)
+		if err == nil {
+			t.Fatalf("error expected for %v", req)
+		}
+	}
+	if validateTotalsConfiguration(map[string]string{"pwr": "x"}, nil) == nil {
+		t.Fatal("unknown method error expected")
+	}
+	if validateTotalsConfiguration(nil, []tariff{{Name: "day", From: 700, To: 2360}}) == nil {
+		t.Fatal("incorrect tariff error expected")
+	}
+	if findTariff([]tariff{{Name: "day", From: 700, To: 2300}}, 65959) != defaultTariff {
+		t.Fatal("default tariff expected")
+	}
+}
@@ -0,0 +1,141 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"smartHome/src/core/entities"
+	"time"
+)
+
+// Virtual sensors are evaluated when source sensor data is stored.
+// Result is stored like any other sensor data, a record having the same time is replaced,
+// so sources updated at the same time give one virtual sensor record.
+
+func (a *DB) buildVirtualSensorMap() {
+	a.virtualSensors = make(map[int][]int)
+	for sensorId, sensor := range a.Sensors {
+		sources := make(map[int]bool)
+		for _, e := range sensor.VirtualProperties() {
+			for _, ref := range e.Sources() {
+				sources[ref.SensorId] = true
+			}
+		}
+		for sourceId := range sources {
+			a.virtualSensors[sourceId] = append(a.virtualSensors[sourceId], sensorId)
+		}
+	}
+}
+
+// returns latest value of the sensor property not later than t, values of current and previous day are used
+func (a *DB) latestValue(ref entities.PropertyRef, t time.Time, maxAge int) (float64, bool) {
+	date := toDate(t)
+	ts := t.Unix()
+	for _, d := range []int{date, toDate(buildDate(date).Add(-time.Hour))} {
+		found := false
+		var latestTime int64
+		var latest int
+		for _, sd := range a.SensorDataMap[d][ref.SensorId] {
+			v, ok := sd.Data.Values[ref.Property]
+			if !ok {
+				continue
+			}
+			st := sampleTime(d, &sd)
+			if st <= ts && (!found || st > latestTime) {
+				found = true
+				latestTime = st
+				latest = v
+			}
+		}
+		if found {
+			if maxAge > 0 && ts-latestTime > int64(maxAge) {
+				return 0, false
+			}
+			return float64(latest) / 100, true
+		}
+	}
+	return 0, false
+}
+
+func (a *DB) evaluateVirtualSensor(sensor *entities.Sensor, t time.Time) map[string]int {
+	values := make(map[string]int)
+	a.mutex.RLock()
+	for name, e := range sensor.VirtualProperties() {
+		v, ok := e.Evaluate(func(ref entities.PropertyRef) (float64, bool) {
+			return a.latestValue(ref, t, sensor.MaxSourceAge)
+		})
+		if ok {
+			value, ok := virtualSensorValue(v)
+			if ok {
+				values[name] = value
+			}
+		}
+	}
+	a.mutex.RUnlock()
+	return values
+}
+
+// returns the value multiplied by 100, false for values which can't be stored
+func virtualSensorValue(v float64) (int, bool) {
+	v = math.Round(v * 100)
+	if math.IsNaN(v) || math.IsInf(v, 0) || math.Abs(v) > 1<<53 {
+		return 0, false
+	}
+	return int(v), true
+}
+
+func (a *DB) updateVirtualSensors(sourceId int, t time.Time) error {
+	a.mutex.RLock()
+	virtualSensors := a.virtualSensors[sourceId]
+	sensors := a.Sensors
+	a.mutex.RUnlock()
+	for _, sensorId := range virtualSensors {
+		sensor := sensors[sensorId]
+		values := a.evaluateVirtualSensor(&sensor, t)
+		if len(values) == 0 {
+			continue
+		}
+		err := a.saveSensorData(sensorId, decodedMessage{MessageTime: t, SensorName: sensor.Name,
+			Message: entities.PropertyMap{Values: values}})
+		if err != nil {
+			return fmt.Errorf("virtual sensor %v: %v", sensor.Name, err.Error())
+		}
+	}
+	return nil
+}
+
+// adds or replaces sensor data having the same time, returns false when stored data is not changed
+func (a *DB) setSensorData(v entities.SensorData, date int, sensorId int) bool {
+	sd := a.SensorDataMap[date][sensorId]
+	for i := range sd {
+		if sd[i].SameTime(&v) {
+			if equalValues(sd[i].Data.Values, v.Data.Values) {
+				return false
+			}
+			sd[i] = v
+			return true
+		}
+	}
+	return a.addToSensorData(v, date, sensorId)
+}
+
+func equalValues(m1 map[string]int, m2 map[string]int) bool {
+	if len(m1) != len(m2) {
+		return false
+	}
+	for k, v := range m1 {
+		v2, ok := m2[k]
+		if !ok || v != v2 {
+			return false
+		}
+	}
+	return true
+}
+
+// virtual sensors data replaces data having the same time
+func (a *DB) storeSensorData(v entities.SensorData, date int, sensorId int) bool {
+	sensor := a.Sensors[sensorId]
+	if sensor.IsVirtual() {
+		return a.setSensorData(v, date, sensorId)
+	}
+	return a.addToSensorData(v, date, sensorId)
+}
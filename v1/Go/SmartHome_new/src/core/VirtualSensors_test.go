@@ -0,0 +1,83 @@
+package core
+
+import (
+	"encoding/json"
+	"os"
+	"smartHome/src/core/entities"
+	"testing"
+	"time"
+)
+
+func TestVirtualSensors(t *testing.T) {
+	sensors := []entities.Sensor{
+		{Id: 1, DataType: "ele"},
+		{Id: 2, DataType: "ele"},
+		{Id: 3, DataType: "ele", Expressions: map[string]string{"pwr": "s1.pwr + s2.pwr"}},
+		{Id: 4, DataType: "ele", Expressions: map[string]string{"pwr": "s3.pwr / 2"}},
+		{Id: 5, DataType: "ele", Expressions: map[string]string{"pwr": "s1.pwr - s2.pwr"}, MaxSourceAge: 600},
+		{Id: 6, DataType: "ele", Expressions: map[string]string{"a": "ln(0 - s1.pwr)", "b": "exp(s1.pwr * 100)"}},
+	}
+	dat, err := json.Marshal(sensors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileName := t.TempDir() + string(os.PathSeparator) + "sensors.json"
+	err = os.WriteFile(fileName, dat, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := DB{
+		SensorDataMap: make(map[int]map[int][]entities.SensorData),
+		DataToBeSaved: make(map[int][]int),
+	}
+	db.Sensors, err = entities.ReadSensorsFromJson(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.buildDeviceToSensors()
+	db.buildVirtualSensorMap()
+	if len(db.DeviceToSensors[0]) != 2 {
+		t.Fatal("virtual sensors should not belong to a device")
+	}
+
+	t1 := time.Date(2021, 1, 7, 10, 0, 0, 0, timeZone)
+	save := func(sensorId int, messageTime time.Time, pwr int) {
+		err := db.saveSensorData(sensorId, decodedMessage{MessageTime: messageTime,
+			Message: entities.PropertyMap{Values: map[string]int{"pwr": pwr}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	save(1, t1, 100)
+	if len(db.SensorDataMap[20210107][3]) != 0 {
+		t.Fatal("no virtual sensor data expected without all sources")
+	}
+	save(2, t1, 200)
+	data := db.SensorDataMap[20210107]
+	if len(data[3]) != 1 || data[3][0].Data.Values["pwr"] != 300 || len(data[4]) != 1 || data[4][0].Data.Values["pwr"] != 150 {
+		t.Fatalf("wrong virtual sensor data: %v %v", data[3], data[4])
+	}
+
+	// same time source update replaces virtual sensor data
+	t2 := t1.Add(time.Minute)
+	save(1, t2, 1000)
+	save(2, t2, 2000)
+	data = db.SensorDataMap[20210107]
+	if len(data[3]) != 2 || data[3][1].Data.Values["pwr"] != 3000 || data[4][1].Data.Values["pwr"] != 1500 {
+		t.Fatalf("wrong virtual sensor data: %v %v", data[3], data[4])
+	}
+
+	if len(data[5]) != 2 || data[5][1].Data.Values["pwr"] != -1000 {
+		t.Fatalf("wrong virtual sensor data: %v", data[5])
+	}
+	if len(data[6]) != 0 {
+		t.Fatalf("values which can't be stored should be rejected: %v", data[6])
+	}
+
+	// sensor 2 value is too old for sensor 5
+	save(1, t2.Add(20*time.Minute), 10)
+	data = db.SensorDataMap[20210107]
+	if len(data[3]) != 3 || len(data[5]) != 2 {
+		t.Fatal("old source values should not be used")
+	}
+}
@@ -0,0 +1,250 @@
+package core
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"smartHome/src/core/entities"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const walFolder = "wal"
+const walFileExtension = ".log"
+
+type walEntry struct {
+	SensorId  int
+	EventTime int
+	Data      entities.PropertyMap
+	Timestamp int64 `json:",omitempty"`
+}
+
+// append only per day log of accepted sensor data, replayed by DB.Load
+type writeAheadLog struct {
+	path  string
+	date  int
+	file  *os.File
+	mutex sync.Mutex
+	// sequence numbers of the last appended and the last synced entry
+	written uint64
+	synced  uint64
+	// serializes fsync calls, so concurrent writers share one sync
+	syncMutex sync.Mutex
+}
+
+func newWriteAheadLog(dataFolder string) *writeAheadLog {
+	return &writeAheadLog{path: dataFolder + string(os.PathSeparator) + walFolder}
+}
+
+func (w *writeAheadLog) fileName(date int) string {
+	return w.path + string(os.PathSeparator) + strconv.Itoa(date) + walFileExtension
+}
+
+func (w *writeAheadLog) open(date int) error {
+	if w.file != nil {
+		if w.date == date {
+			return nil
+		}
+		w.closeFile()
+	}
+	err := os.MkdirAll(w.path, 0755)
+	if err != nil {
+		return err
+	}
+	w.file, err = os.OpenFile(w.fileName(date), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	w.date = date
+	return nil
+}
+
+// stores data with the store function and appends it to the log when it is stored.
+// The log mutex is held until the entry is appended, so compact can't remove the log of not saved data,
+// store should hold the DB lock only while sensor data is changed.
+// The entry is synced after the log mutex is released, together with entries appended by concurrent writers.
+func (w *writeAheadLog) add(date int, sensorId int, data entities.SensorData, store func() bool) (bool, error) {
+	bytes, err := json.Marshal(&walEntry{
+		SensorId:  sensorId,
+		EventTime: data.EventTime,
+		Data:      data.Data,
+		Timestamp: data.Timestamp,
+	})
+	w.mutex.Lock()
+	if !store() {
+		w.mutex.Unlock()
+		return false, nil
+	}
+	if err != nil {
+		w.mutex.Unlock()
+		return true, err
+	}
+	seq, err := w.write(date, bytes)
+	w.mutex.Unlock()
+	if err != nil {
+		return true, err
+	}
+	return true, w.sync(seq)
+}
+
+// appends the entry to the log and returns its sequence number, should be called with the log mutex held
+func (w *writeAheadLog) write(date int, bytes []byte) (uint64, error) {
+	err := w.open(date)
+	if err != nil {
+		return 0, err
+	}
+	_, err = w.file.Write(append(bytes, '\n'))
+	if err != nil {
+		return 0, err
+	}
+	w.written++
+	return w.written, nil
+}
+
+// syncs the log file up to the entry with given sequence number.
+// One fsync covers all entries appended before it, later callers return without syncing.
+func (w *writeAheadLog) sync(seq uint64) error {
+	w.syncMutex.Lock()
+	defer w.syncMutex.Unlock()
+	w.mutex.Lock()
+	if w.synced >= seq {
+		w.mutex.Unlock()
+		return nil
+	}
+	file := w.file
+	written := w.written
+	w.mutex.Unlock()
+
+	err := file.Sync()
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if err != nil {
+		// file was synced and closed by open or compact in the meantime
+		if w.synced >= seq {
+			return nil
+		}
+		return err
+	}
+	if written > w.synced {
+		w.synced = written
+	}
+	return nil
+}
+
+// syncs and closes the current log file, should be called with the log mutex held
+func (w *writeAheadLog) closeFile() {
+	err := w.file.Sync()
+	if err != nil {
+		fmt.Printf("Write ahead log file sync error: %v\n", err.Error())
+	} else {
+		w.synced = w.written
+	}
+	_ = w.file.Close()
+	w.file = nil
+}
+
+// removes log files for all dates that have no unsaved data
+func (w *writeAheadLog) compact(unsaved func(date int) bool) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	dates, err := listWalDates(w.path)
+	if err != nil {
+		fmt.Printf("Write ahead log folder read error: %v\n", err.Error())
+		return
+	}
+	for _, date := range dates {
+		if unsaved(date) {
+			continue
+		}
+		if w.file != nil && w.date == date {
+			w.closeFile()
+		}
+		err = os.Remove(w.fileName(date))
+		if err != nil {
+			fmt.Printf("Write ahead log file removal error: %v\n", err.Error())
+		}
+	}
+}
+
+func (w *writeAheadLog) Close() {
+	w.mutex.Lock()
+	if w.file != nil {
+		w.closeFile()
+	}
+	w.mutex.Unlock()
+}
+
+func listWalDates(path string) ([]int, error) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var result []int
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, walFileExtension) {
+			continue
+		}
+		date, err := strconv.Atoi(name[:len(name)-len(walFileExtension)])
+		if err == nil {
+			result = append(result, date)
+		}
+	}
+	return result, nil
+}
+
+func readWalFile(fileName string) ([]walEntry, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var result []walEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 4096), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var entry walEntry
+		// last line can be incomplete after a crash
+		if err := json.Unmarshal(line, &entry); err != nil {
+			fmt.Printf("Write ahead log entry decode error: %v %v\n", fileName, err.Error())
+			continue
+		}
+		result = append(result, entry)
+	}
+	return result, scanner.Err()
+}
+
+// replays write ahead log files into SensorDataMap, returns replayed dates
+func (a *DB) replayWriteAheadLog(dataFolder string) ([]int, error) {
+	path := dataFolder + string(os.PathSeparator) + walFolder
+	dates, err := listWalDates(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, date := range dates {
+		entries, err := readWalFile(path + string(os.PathSeparator) + strconv.Itoa(date) + walFileExtension)
+		if err != nil {
+			return nil, err
+		}
+		cnt := 0
+		for _, entry := range entries {
+			data := entities.SensorData{EventTime: entry.EventTime, Data: entry.Data, Timestamp: entry.Timestamp}
+			if a.storeSensorData(data, date, entry.SensorId) {
+				a.addToDataToBeSaved(date, entry.SensorId)
+				cnt++
+			}
+		}
+		fmt.Printf("Write ahead log for %v: %v entries replayed\n", date, cnt)
+	}
+	return dates, nil
+}
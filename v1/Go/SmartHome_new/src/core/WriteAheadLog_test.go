@@ -0,0 +1,133 @@
+package core
+
+import (
+	"os"
+	"smartHome/src/core/entities"
+	"sync"
+	"testing"
+)
+
+func TestWriteAheadLogReplay(t *testing.T) {
+	folder := t.TempDir()
+	wal := newWriteAheadLog(folder)
+	stored := func() bool { return true }
+	for i := 0; i < 5; i++ {
+		_, err := wal.add(20210107, 1, entities.SensorData{
+			EventTime: i * 500,
+			Data:      entities.PropertyMap{Values: map[string]int{"temp": 2000 + i}},
+		}, stored)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// duplicate event time should be ignored on replay
+	_, err := wal.add(20210107, 1, entities.SensorData{
+		EventTime: 0,
+		Data:      entities.PropertyMap{Values: map[string]int{"temp": 1}},
+	}, stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = wal.add(20210108, 2, entities.SensorData{
+		EventTime: 100,
+		Data:      entities.PropertyMap{Values: map[string]int{"humi": 5000}},
+	}, stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wal.Close()
+
+	// simulate a crash in the middle of a write
+	f, err := os.OpenFile(wal.fileName(20210108), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.Write([]byte("{\"SensorId\":2,\"EventT"))
+	_ = f.Close()
+
+	db := DB{
+		SensorDataMap: make(map[int]map[int][]entities.SensorData),
+		DataToBeSaved: make(map[int][]int),
+	}
+	dates, err := db.replayWriteAheadLog(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dates) != 2 {
+		t.Fatalf("wrong replayed dates length: %v", len(dates))
+	}
+	l := len(db.SensorDataMap[20210107][1])
+	if l != 5 {
+		t.Fatalf("wrong replayed data length: %v", l)
+	}
+	if db.SensorDataMap[20210107][1][0].Data.Values["temp"] != 2000 {
+		t.Fatal("wrong replayed temp value")
+	}
+	if db.SensorDataMap[20210108][2][0].Data.Values["humi"] != 5000 {
+		t.Fatal("wrong replayed humi value")
+	}
+	if len(db.DataToBeSaved) != 2 {
+		t.Fatalf("wrong DataToBeSaved length: %v", len(db.DataToBeSaved))
+	}
+
+	wal.compact(func(date int) bool { return date == 20210108 })
+	if _, err := os.Stat(wal.fileName(20210107)); !os.IsNotExist(err) {
+		t.Fatal("log file for 20210107 should be removed")
+	}
+	if _, err := os.Stat(wal.fileName(20210108)); err != nil {
+		t.Fatal("log file for 20210108 should be kept")
+	}
+}
+
+func TestWriteAheadLogNotStored(t *testing.T) {
+	wal := newWriteAheadLog(t.TempDir())
+	defer wal.Close()
+	added, err := wal.add(20210107, 1, entities.SensorData{EventTime: 100}, func() bool { return false })
+	if err != nil || added {
+		t.Fatalf("not stored data should not be logged: %v %v", added, err)
+	}
+	if _, err := os.Stat(wal.fileName(20210107)); !os.IsNotExist(err) {
+		t.Fatal("log file should not be created")
+	}
+}
+
+func TestWriteAheadLogConcurrentAdd(t *testing.T) {
+	folder := t.TempDir()
+	wal := newWriteAheadLog(folder)
+	var wg sync.WaitGroup
+	errs := make(chan error, 100)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := wal.add(20210107+i%2, i, entities.SensorData{
+				EventTime: i,
+				Data:      entities.PropertyMap{Values: map[string]int{"temp": i}},
+			}, func() bool { return true })
+			if err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	if wal.synced != wal.written || wal.written != 100 {
+		t.Fatalf("wrong sequence numbers: %v %v", wal.written, wal.synced)
+	}
+	wal.Close()
+
+	cnt := 0
+	for _, date := range []int{20210107, 20210108} {
+		entries, err := readWalFile(wal.fileName(date))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cnt += len(entries)
+	}
+	if cnt != 100 {
+		t.Fatalf("wrong logged entries count: %v", cnt)
+	}
+}
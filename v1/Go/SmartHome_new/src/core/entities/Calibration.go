@@ -0,0 +1,93 @@
+package entities
+
+import (
+	"fmt"
+	"math"
+)
+
+// Calibration is applied to a property value in physical units (stored value / 100).
+// When Table is set, the value is interpolated between table points,
+// otherwise value * Scale + Offset is used (Scale 0 means 1).
+// Unit conversion is applied to the calibrated value.
+type Calibration struct {
+	Scale  float64
+	Offset float64
+	// piecewise linear table of [raw, calibrated] points sorted by raw value
+	Table [][2]float64
+	Unit  string
+}
+
+var unitConversions = map[string]func(float64) float64{
+	"c_to_f":      func(v float64) float64 { return v*1.8 + 32 },
+	"f_to_c":      func(v float64) float64 { return (v - 32) / 1.8 },
+	"pa_to_hpa":   func(v float64) float64 { return v / 100 },
+	"hpa_to_mmhg": func(v float64) float64 { return v * 0.750062 },
+	"mmhg_to_hpa": func(v float64) float64 { return v / 0.750062 },
+	"w_to_kw":     func(v float64) float64 { return v / 1000 },
+	"kw_to_w":     func(v float64) float64 { return v * 1000 },
+	"wh_to_kwh":   func(v float64) float64 { return v / 1000 },
+}
+
+func (c *Calibration) Validate() error {
+	if len(c.Table) == 1 {
+		return fmt.Errorf("calibration table should contain at least 2 points")
+	}
+	for i := 1; i < len(c.Table); i++ {
+		if c.Table[i][0] <= c.Table[i-1][0] {
+			return fmt.Errorf("calibration table is not sorted")
+		}
+	}
+	if len(c.Unit) > 0 {
+		_, ok := unitConversions[c.Unit]
+		if !ok {
+			return fmt.Errorf("unknown unit conversion %v", c.Unit)
+		}
+	}
+	return nil
+}
+
+func interpolate(table [][2]float64, value float64) float64 {
+	i := 1
+	for i < len(table)-1 && value > table[i][0] {
+		i++
+	}
+	p1 := table[i-1]
+	p2 := table[i]
+	return p1[1] + (value-p1[0])*(p2[1]-p1[1])/(p2[0]-p1[0])
+}
+
+func (c *Calibration) Apply(value float64) float64 {
+	if len(c.Table) > 0 {
+		value = interpolate(c.Table, value)
+	} else {
+		scale := c.Scale
+		if scale == 0 {
+			scale = 1
+		}
+		value = value*scale + c.Offset
+	}
+	if len(c.Unit) > 0 {
+		value = unitConversions[c.Unit](value)
+	}
+	return value
+}
+
+// Calibrate updates property values using sensor calibrations and legacy offsets
+func (s *Sensor) Calibrate(m PropertyMap) {
+	for name, offset := range s.Offsets {
+		_, ok := s.Calibration[name]
+		if ok {
+			continue
+		}
+		value, ok := m.Values[name]
+		if ok {
+			m.Values[name] = value + offset
+		}
+	}
+	for name, c := range s.Calibration {
+		value, ok := m.Values[name]
+		if ok {
+			m.Values[name] = int(math.Round(c.Apply(float64(value)/100) * 100))
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package entities
+
+import "testing"
+
+func TestCalibration(t *testing.T) {
+	sensor := Sensor{
+		Offsets: map[string]int{"temp": -100, "humi": 500},
+		Calibration: map[string]Calibration{
+			"humi": {Table: [][2]float64{{0, 0}, {50, 45}, {100, 100}}},
+			"temp": {Scale: 1.1, Offset: 0.5, Unit: "c_to_f"},
+			"pres": {Unit: "hpa_to_mmhg"},
+		},
+	}
+	m := PropertyMap{Values: map[string]int{"temp": 2000, "humi": 7500, "pres": 100000, "vbat": 300}}
+	sensor.Calibrate(m)
+	if m.Values["temp"] != 7250 {
+		t.Fatalf("wrong temp value %v", m.Values["temp"])
+	}
+	if m.Values["humi"] != 7250 {
+		t.Fatalf("wrong humi value %v", m.Values["humi"])
+	}
+	if m.Values["pres"] != 75006 {
+		t.Fatalf("wrong pres value %v", m.Values["pres"])
+	}
+	if m.Values["vbat"] != 300 {
+		t.Fatalf("wrong vbat value %v", m.Values["vbat"])
+	}
+
+	c := Calibration{Table: [][2]float64{{10, 20}, {20, 30}}}
+	if c.Apply(5) != 15 || c.Apply(25) != 35 {
+		t.Fatal("table should be extrapolated")
+	}
+}
+
+func TestCalibrationValidate(t *testing.T) {
+	c := Calibration{Table: [][2]float64{{10, 20}, {5, 30}}}
+	if c.Validate() == nil {
+		t.Fatal("unsorted table should be rejected")
+	}
+	c = Calibration{Unit: "unknown"}
+	if c.Validate() == nil {
+		t.Fatal("unknown unit should be rejected")
+	}
+	c = Calibration{Scale: 2, Unit: "w_to_kw"}
+	if c.Validate() != nil {
+		t.Fatal("valid calibration rejected")
+	}
+}
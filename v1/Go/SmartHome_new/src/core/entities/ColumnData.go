@@ -0,0 +1,290 @@
+package entities
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// column file layout (after the magic, gzip compressed):
+// sensor count, then for each sensor:
+//   sensor id, row count, event time deltas,
+//   timestamp presence flag (0 - none, 1 - all rows, 2 - bitmap follows) and timestamp deltas (SHC2 only),
+//   column count, then for each column:
+//     property name, presence flag (+ bitmap when not all rows have the property), value deltas
+// all numbers are varints, deltas are zigzag encoded
+
+var columnFileMagic = []byte("SHC2")
+
+// files without timestamps
+var columnFileMagicV1 = []byte("SHC1")
+
+type columnWriter struct {
+	buf bytes.Buffer
+	tmp [binary.MaxVarintLen64]byte
+}
+
+func (w *columnWriter) putUvarint(v uint64) {
+	n := binary.PutUvarint(w.tmp[:], v)
+	w.buf.Write(w.tmp[:n])
+}
+
+func (w *columnWriter) putVarint(v int64) {
+	n := binary.PutVarint(w.tmp[:], v)
+	w.buf.Write(w.tmp[:n])
+}
+
+func (w *columnWriter) putString(s string) {
+	w.putUvarint(uint64(len(s)))
+	w.buf.WriteString(s)
+}
+
+func EncodeColumnData(data map[int][]SensorData) ([]byte, error) {
+	var w columnWriter
+
+	var sensorIds []int
+	for sensorId := range data {
+		sensorIds = append(sensorIds, sensorId)
+	}
+	sort.Ints(sensorIds)
+
+	w.putUvarint(uint64(len(sensorIds)))
+	for _, sensorId := range sensorIds {
+		rows := data[sensorId]
+		w.putUvarint(uint64(sensorId))
+		w.putUvarint(uint64(len(rows)))
+		prev := 0
+		for _, row := range rows {
+			w.putVarint(int64(row.EventTime - prev))
+			prev = row.EventTime
+		}
+		w.putTimestamps(rows)
+		keys := columnKeys(rows)
+		w.putUvarint(uint64(len(keys)))
+		for _, key := range keys {
+			w.putString(key)
+			bitmap, all := columnPresence(rows, key)
+			if all {
+				w.buf.WriteByte(1)
+			} else {
+				w.buf.WriteByte(0)
+				w.buf.Write(bitmap)
+			}
+			prev = 0
+			for _, row := range rows {
+				v, ok := row.Data.Values[key]
+				if ok {
+					w.putVarint(int64(v - prev))
+					prev = v
+				}
+			}
+		}
+	}
+
+	var out bytes.Buffer
+	out.Write(columnFileMagic)
+	zw, err := gzip.NewWriterLevel(&out, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	_, err = zw.Write(w.buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func (w *columnWriter) putTimestamps(rows []SensorData) {
+	bitmap := make([]byte, (len(rows)+7)/8)
+	count := 0
+	for i, row := range rows {
+		if row.Timestamp != 0 {
+			bitmap[i/8] |= 1 << (i % 8)
+			count++
+		}
+	}
+	switch count {
+	case 0:
+		w.buf.WriteByte(0)
+		return
+	case len(rows):
+		w.buf.WriteByte(1)
+	default:
+		w.buf.WriteByte(2)
+		w.buf.Write(bitmap)
+	}
+	var prev int64
+	for _, row := range rows {
+		if row.Timestamp != 0 {
+			w.putVarint(row.Timestamp - prev)
+			prev = row.Timestamp
+		}
+	}
+}
+
+func readTimestamps(r *bytes.Reader, rows []SensorData) error {
+	flag, err := r.ReadByte()
+	if err != nil || flag == 0 {
+		return err
+	}
+	var bitmap []byte
+	if flag == 2 {
+		bitmap = make([]byte, (len(rows)+7)/8)
+		_, err = io.ReadFull(r, bitmap)
+		if err != nil {
+			return err
+		}
+	}
+	var prev int64
+	for i := range rows {
+		if bitmap != nil && bitmap[i/8]&(1<<(i%8)) == 0 {
+			continue
+		}
+		delta, err := binary.ReadVarint(r)
+		if err != nil {
+			return err
+		}
+		prev += delta
+		rows[i].Timestamp = prev
+	}
+	return nil
+}
+
+func columnKeys(rows []SensorData) []string {
+	keyMap := make(map[string]bool)
+	for _, row := range rows {
+		for k := range row.Data.Values {
+			keyMap[k] = true
+		}
+	}
+	var keys []string
+	for k := range keyMap {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func columnPresence(rows []SensorData, key string) ([]byte, bool) {
+	bitmap := make([]byte, (len(rows)+7)/8)
+	all := true
+	for i, row := range rows {
+		_, ok := row.Data.Values[key]
+		if ok {
+			bitmap[i/8] |= 1 << (i % 8)
+		} else {
+			all = false
+		}
+	}
+	return bitmap, all
+}
+
+func DecodeColumnData(data []byte) (map[int][]SensorData, error) {
+	hasTimestamps := bytes.HasPrefix(data, columnFileMagic)
+	if !hasTimestamps && !bytes.HasPrefix(data, columnFileMagicV1) {
+		return nil, fmt.Errorf("not a column file")
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data[len(columnFileMagic):]))
+	if err != nil {
+		return nil, err
+	}
+	raw, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, err
+	}
+	r := bytes.NewReader(raw)
+
+	sensorCount, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[int][]SensorData)
+	for ; sensorCount > 0; sensorCount-- {
+		sensorId, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		rowCount, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		// every row takes at least one byte for event time delta
+		if rowCount > uint64(r.Len()) {
+			return nil, fmt.Errorf("sensor %v: invalid row count %v", sensorId, rowCount)
+		}
+		rows := make([]SensorData, rowCount)
+		prev := 0
+		for i := range rows {
+			delta, err := binary.ReadVarint(r)
+			if err != nil {
+				return nil, err
+			}
+			prev += int(delta)
+			rows[i] = SensorData{EventTime: prev, Data: PropertyMap{Values: make(map[string]int)}}
+		}
+		if hasTimestamps {
+			err = readTimestamps(r, rows)
+			if err != nil {
+				return nil, err
+			}
+		}
+		columnCount, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		for ; columnCount > 0; columnCount-- {
+			err = readColumn(r, rows)
+			if err != nil {
+				return nil, err
+			}
+		}
+		result[int(sensorId)] = rows
+	}
+	return result, nil
+}
+
+func readColumn(r *bytes.Reader, rows []SensorData) error {
+	l, err := binary.ReadUvarint(r)
+	if err != nil {
+		return err
+	}
+	if l > uint64(r.Len()) {
+		return fmt.Errorf("invalid column name length %v", l)
+	}
+	key := make([]byte, l)
+	_, err = io.ReadFull(r, key)
+	if err != nil {
+		return err
+	}
+	all, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	var bitmap []byte
+	if all == 0 {
+		bitmap = make([]byte, (len(rows)+7)/8)
+		_, err = io.ReadFull(r, bitmap)
+		if err != nil {
+			return err
+		}
+	}
+	prev := 0
+	for i, row := range rows {
+		if bitmap != nil && bitmap[i/8]&(1<<(i%8)) == 0 {
+			continue
+		}
+		delta, err := binary.ReadVarint(r)
+		if err != nil {
+			return err
+		}
+		prev += int(delta)
+		row.Data.Values[string(key)] = prev
+	}
+	return nil
+}
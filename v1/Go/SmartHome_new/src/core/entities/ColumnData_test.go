@@ -0,0 +1,87 @@
+package entities
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestColumnDataRoundTrip(t *testing.T) {
+	data := map[int][]SensorData{
+		1: {
+			{EventTime: 0, Data: PropertyMap{Values: map[string]int{"temp": -150, "humi": 5000}}},
+			{EventTime: 500, Data: PropertyMap{Values: map[string]int{"temp": -120}}},
+			{EventTime: 1000, Data: PropertyMap{Values: map[string]int{"temp": 30, "humi": 4800, "vbat": 410}}},
+		},
+		5: {
+			{EventTime: 235959, Data: PropertyMap{Values: map[string]int{"pwr": 123400}}},
+			{EventTime: 100, Data: PropertyMap{Values: map[string]int{"pwr": 0}}},
+		},
+		7: {
+			{EventTime: 33000, Timestamp: 1635640200, Data: PropertyMap{Values: map[string]int{"temp": 10}}},
+			{EventTime: 33000, Timestamp: 1635643800, Data: PropertyMap{Values: map[string]int{"temp": 20}}},
+		},
+		8: {
+			{EventTime: 100, Data: PropertyMap{Values: map[string]int{"temp": 10}}},
+			{EventTime: 200, Timestamp: 1635643800, Data: PropertyMap{Values: map[string]int{"temp": 20}}},
+		},
+	}
+	encoded, err := EncodeColumnData(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeColumnData(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(data, decoded) {
+		t.Fatalf("decoded data differs: %v", decoded)
+	}
+}
+
+func TestColumnDataSize(t *testing.T) {
+	dat, err := os.ReadFile("../../../test_resources/db/dates_new/20210107/1.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sensorData []SensorData
+	if err := json.Unmarshal(dat, &sensorData); err != nil {
+		t.Fatal(err)
+	}
+	data := map[int][]SensorData{1: sensorData}
+	encoded, err := EncodeColumnData(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(encoded)*10 > len(dat) {
+		t.Errorf("column file is too big: %v, json file size: %v", len(encoded), len(dat))
+	}
+	decoded, err := DecodeColumnData(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(data, decoded) {
+		t.Fatal("decoded data differs")
+	}
+}
+
+func TestColumnDataInvalidRowCount(t *testing.T) {
+	var body []byte
+	body = binary.AppendUvarint(body, 1)
+	body = binary.AppendUvarint(body, 1)
+	body = binary.AppendUvarint(body, 1<<40)
+	body = append(body, 0, 0)
+	var out bytes.Buffer
+	out.Write(columnFileMagic)
+	zw := gzip.NewWriter(&out)
+	_, _ = zw.Write(body)
+	_ = zw.Close()
+	_, err := DecodeColumnData(out.Bytes())
+	if err == nil {
+		t.Fatal("row count error expected")
+	}
+}
@@ -0,0 +1,301 @@
+package entities
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Expression is a virtual sensor property expression over other sensors properties.
+// Operators: + - * / and parentheses, sensor property reference: s<sensor id>.<property name>,
+// functions: abs(x), min(x, y), max(x, y), sqrt(x), exp(x), ln(x), dewpoint(temp, humi).
+// Values are in physical units (stored value / 100).
+type Expression struct {
+	root    expressionNode
+	sources []PropertyRef
+}
+
+type PropertyRef struct {
+	SensorId int
+	Property string
+}
+
+// returns property value, false when the value is not available
+type PropertyValueGetter func(ref PropertyRef) (float64, bool)
+
+type expressionNode interface {
+	eval(get PropertyValueGetter) (float64, bool)
+}
+
+type numberNode float64
+
+func (n numberNode) eval(PropertyValueGetter) (float64, bool) {
+	return float64(n), true
+}
+
+type refNode PropertyRef
+
+func (n refNode) eval(get PropertyValueGetter) (float64, bool) {
+	return get(PropertyRef(n))
+}
+
+type binaryNode struct {
+	op          byte
+	left, right expressionNode
+}
+
+func (n *binaryNode) eval(get PropertyValueGetter) (float64, bool) {
+	l, ok := n.left.eval(get)
+	if !ok {
+		return 0, false
+	}
+	r, ok := n.right.eval(get)
+	if !ok {
+		return 0, false
+	}
+	switch n.op {
+	case '+':
+		return l + r, true
+	case '-':
+		return l - r, true
+	case '*':
+		return l * r, true
+	default:
+		if r == 0 {
+			return 0, false
+		}
+		return l / r, true
+	}
+}
+
+type functionNode struct {
+	f    func(args []float64) float64
+	args []expressionNode
+}
+
+func (n *functionNode) eval(get PropertyValueGetter) (float64, bool) {
+	args := make([]float64, len(n.args))
+	for i, a := range n.args {
+		v, ok := a.eval(get)
+		if !ok {
+			return 0, false
+		}
+		args[i] = v
+	}
+	return n.f(args), true
+}
+
+type expressionFunction struct {
+	argCount int
+	f        func(args []float64) float64
+}
+
+// Magnus formula
+func dewPoint(temp float64, humi float64) float64 {
+	const b = 17.62
+	const c = 243.12
+	gamma := math.Log(humi/100) + b*temp/(c+temp)
+	return c * gamma / (b - gamma)
+}
+
+var expressionFunctions = map[string]expressionFunction{
+	"abs":      {1, func(a []float64) float64 { return math.Abs(a[0]) }},
+	"min":      {2, func(a []float64) float64 { return math.Min(a[0], a[1]) }},
+	"max":      {2, func(a []float64) float64 { return math.Max(a[0], a[1]) }},
+	"sqrt":     {1, func(a []float64) float64 { return math.Sqrt(a[0]) }},
+	"exp":      {1, func(a []float64) float64 { return math.Exp(a[0]) }},
+	"ln":       {1, func(a []float64) float64 { return math.Log(a[0]) }},
+	"dewpoint": {2, func(a []float64) float64 { return dewPoint(a[0], a[1]) }},
+}
+
+type expressionParser struct {
+	s       string
+	pos     int
+	sources []PropertyRef
+}
+
+func ParseExpression(s string) (*Expression, error) {
+	p := expressionParser{s: s}
+	root, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+	if p.pos < len(p.s) {
+		return nil, fmt.Errorf("unexpected character at position %v in expression %v", p.pos, s)
+	}
+	if len(p.sources) == 0 {
+		return nil, fmt.Errorf("expression %v has no sensor references", s)
+	}
+	return &Expression{root: root, sources: p.sources}, nil
+}
+
+// Sources returns sensor properties used by the expression
+func (e *Expression) Sources() []PropertyRef {
+	return e.sources
+}
+
+// Evaluate returns false when some source value is not available or the result is not a number
+func (e *Expression) Evaluate(get PropertyValueGetter) (float64, bool) {
+	v, ok := e.root.eval(get)
+	if !ok || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, false
+	}
+	return v, true
+}
+
+func (p *expressionParser) skipSpaces() {
+	for p.pos < len(p.s) && p.s[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+// returns next non space character, 0 at the end of expression
+func (p *expressionParser) peek() byte {
+	p.skipSpaces()
+	if p.pos < len(p.s) {
+		return p.s[p.pos]
+	}
+	return 0
+}
+
+func (p *expressionParser) error(message string) error {
+	return fmt.Errorf("%v at position %v in expression %v", message, p.pos, p.s)
+}
+
+func (p *expressionParser) parseSum() (expressionNode, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		if op != '+' && op != '-' {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *expressionParser) parseProduct() (expressionNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		if op != '*' && op != '/' {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *expressionParser) parseUnary() (expressionNode, error) {
+	if p.peek() == '-' {
+		p.pos++
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &binaryNode{op: '-', left: numberNode(0), right: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || c == '.' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func (p *expressionParser) parsePrimary() (expressionNode, error) {
+	c := p.peek()
+	switch {
+	case c == '(':
+		p.pos++
+		node, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, p.error("missing )")
+		}
+		p.pos++
+		return node, nil
+	case (c >= '0' && c <= '9') || c == '.':
+		start := p.pos
+		for p.pos < len(p.s) && ((p.s[p.pos] >= '0' && p.s[p.pos] <= '9') || p.s[p.pos] == '.') {
+			p.pos++
+		}
+		v, err := strconv.ParseFloat(p.s[start:p.pos], 64)
+		if err != nil {
+			return nil, p.error("invalid number")
+		}
+		return numberNode(v), nil
+	case isNameChar(c):
+		start := p.pos
+		for p.pos < len(p.s) && isNameChar(p.s[p.pos]) {
+			p.pos++
+		}
+		name := p.s[start:p.pos]
+		if p.peek() == '(' {
+			return p.parseFunction(name)
+		}
+		return p.parseReference(name)
+	default:
+		return nil, p.error("unexpected character")
+	}
+}
+
+func (p *expressionParser) parseReference(name string) (expressionNode, error) {
+	idx := strings.Index(name, ".")
+	if idx < 2 || name[0] != 's' || idx == len(name)-1 {
+		return nil, p.error("invalid sensor property reference " + name)
+	}
+	sensorId, err := strconv.Atoi(name[1:idx])
+	if err != nil {
+		return nil, p.error("invalid sensor property reference " + name)
+	}
+	ref := PropertyRef{SensorId: sensorId, Property: name[idx+1:]}
+	p.sources = append(p.sources, ref)
+	return refNode(ref), nil
+}
+
+func (p *expressionParser) parseFunction(name string) (expressionNode, error) {
+	f, ok := expressionFunctions[name]
+	if !ok {
+		return nil, p.error("unknown function " + name)
+	}
+	// skip (
+	p.pos++
+	var args []expressionNode
+	for {
+		arg, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		c := p.peek()
+		p.pos++
+		if c == ')' {
+			break
+		}
+		if c != ',' {
+			return nil, p.error("missing )")
+		}
+	}
+	if len(args) != f.argCount {
+		return nil, p.error("wrong number of arguments for function " + name)
+	}
+	return &functionNode{f: f.f, args: args}, nil
+}
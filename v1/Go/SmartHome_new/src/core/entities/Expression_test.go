@@ -0,0 +1,83 @@
+package entities
+
+import (
+	"math"
+	"testing"
+)
+
+func TestExpression(t *testing.T) {
+	values := map[PropertyRef]float64{{1, "temp"}: 20, {1, "humi"}: 50, {2, "temp"}: -5}
+	get := func(ref PropertyRef) (float64, bool) {
+		v, ok := values[ref]
+		return v, ok
+	}
+	tests := map[string]float64{
+		"s1.temp - s2.temp":               25,
+		"-s2.temp * 2 + 1":                11,
+		"(s1.temp + s2.temp) / 3":         5,
+		"max(s1.temp, s2.temp) - abs(-1)": 19,
+		"dewpoint(s1.temp, s1.humi)":      9.26,
+	}
+	for s, expected := range tests {
+		e, err := ParseExpression(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, ok := e.Evaluate(get)
+		if !ok || math.Abs(v-expected) > 0.01 {
+			t.Fatalf("%v: wrong result %v", s, v)
+		}
+	}
+
+	e, err := ParseExpression("s1.temp / (s2.temp + 5)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(e.Sources()) != 2 || e.Sources()[1] != (PropertyRef{2, "temp"}) {
+		t.Fatalf("wrong sources: %v", e.Sources())
+	}
+	if _, ok := e.Evaluate(get); ok {
+		t.Fatal("division by zero should give no value")
+	}
+	e, _ = ParseExpression("s3.temp + 1")
+	if _, ok := e.Evaluate(get); ok {
+		t.Fatal("missing source should give no value")
+	}
+
+	for _, s := range []string{"", "1 + 2", "s1.temp +", "s1.temp)", "x.temp", "s1.", "foo(s1.temp)", "min(s1.temp)",
+		"(s1.temp"} {
+		_, err = ParseExpression(s)
+		if err == nil {
+			t.Fatalf("error expected for %v", s)
+		}
+	}
+}
+
+func TestValidateVirtualSensors(t *testing.T) {
+	sensors := map[int]Sensor{
+		1: {Id: 1},
+		2: {Id: 2, Expressions: map[string]string{"temp": "s1.temp + s3.temp"}},
+		3: {Id: 3, Expressions: map[string]string{"temp": "s1.temp * 2"}},
+	}
+	for id, s := range sensors {
+		if err := s.parseExpressions(); err != nil {
+			t.Fatal(err)
+		}
+		sensors[id] = s
+	}
+	if err := validateVirtualSensors(sensors); err != nil {
+		t.Fatal(err)
+	}
+	s := Sensor{Id: 1, Expressions: map[string]string{"temp": "s2.temp"}}
+	_ = s.parseExpressions()
+	sensors[1] = s
+	if validateVirtualSensors(sensors) == nil {
+		t.Fatal("circular reference error expected")
+	}
+	s = Sensor{Id: 1, Expressions: map[string]string{"temp": "s4.temp"}}
+	_ = s.parseExpressions()
+	sensors[1] = s
+	if validateVirtualSensors(sensors) == nil {
+		t.Fatal("unknown sensor error expected")
+	}
+}
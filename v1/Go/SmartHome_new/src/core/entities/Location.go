@@ -2,7 +2,9 @@ package entities
 
 import (
     "encoding/json"
+    "fmt"
     "os"
+    "sort"
 )
 
 type Location struct {
@@ -11,6 +13,16 @@ type Location struct {
     LocationType string
 }
 
+func (l *Location) Validate() error {
+    if l.Id <= 0 {
+        return fmt.Errorf("invalid location id %v", l.Id)
+    }
+    if len(l.Name) == 0 {
+        return fmt.Errorf("location %v: empty name", l.Id)
+    }
+    return nil
+}
+
 func ReadLocationsFromJson(path string) (map[int]Location, error) {
     var locations []Location
     dat, err := os.ReadFile(path)
@@ -28,3 +40,13 @@ func ReadLocationsFromJson(path string) (map[int]Location, error) {
 
     return result, nil
 }
+
+// WriteLocationsToJson writes locations sorted by id, file is replaced atomically
+func WriteLocationsToJson(path string, locations map[int]Location) error {
+    var list []Location
+    for _, l := range locations {
+        list = append(list, l)
+    }
+    sort.Slice(list, func(i, j int) bool { return list[i].Id < list[j].Id })
+    return writeJsonFile(path, list)
+}
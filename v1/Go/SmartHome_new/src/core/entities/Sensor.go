@@ -2,7 +2,10 @@ package entities
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
+	"smartHome/src/core/files"
+	"sort"
 )
 
 type Sensor struct {
@@ -11,8 +14,122 @@ type Sensor struct {
 	DataType      string
 	LocationId    int
 	DeviceId      int
-	DeviceSensors map[int]string
-	Offsets       map[string]int
+	DeviceSensors map[int]string `json:",omitempty"`
+	// offsets added to stored values, ignored for properties having calibration
+	Offsets map[string]int `json:",omitempty"`
+	// map property name -> calibration
+	Calibration map[string]Calibration `json:",omitempty"`
+	// seconds between sensor reports, 0 - sensor is not watched
+	ExpectedInterval int `json:",omitempty"`
+	// virtual sensor: map property name -> expression over other sensors properties,
+	// evaluated when source sensors are updated
+	Expressions map[string]string `json:",omitempty"`
+	// virtual sensor: maximum age of source values in seconds, 0 - source values of current and previous day are used
+	MaxSourceAge int `json:",omitempty"`
+	expressions  map[string]*Expression
+}
+
+func (s *Sensor) IsVirtual() bool {
+	return len(s.Expressions) > 0
+}
+
+// VirtualProperties returns parsed expressions of virtual sensor properties
+func (s *Sensor) VirtualProperties() map[string]*Expression {
+	return s.expressions
+}
+
+func (s *Sensor) parseExpressions() error {
+	if !s.IsVirtual() {
+		return nil
+	}
+	s.expressions = make(map[string]*Expression)
+	for name, e := range s.Expressions {
+		expression, err := ParseExpression(e)
+		if err != nil {
+			return fmt.Errorf("sensor %v property %v: %v", s.Id, name, err.Error())
+		}
+		s.expressions[name] = expression
+	}
+	return nil
+}
+
+// checks that virtual sensors use existing sensors and have no circular references
+func validateVirtualSensors(sensors map[int]Sensor) error {
+	// 1 - in progress, 2 - checked
+	state := make(map[int]int)
+	var check func(sensorId int) error
+	check = func(sensorId int) error {
+		switch state[sensorId] {
+		case 1:
+			return fmt.Errorf("circular reference in virtual sensor %v", sensorId)
+		case 2:
+			return nil
+		}
+		state[sensorId] = 1
+		sensor := sensors[sensorId]
+		for _, e := range sensor.expressions {
+			for _, ref := range e.Sources() {
+				_, ok := sensors[ref.SensorId]
+				if !ok {
+					return fmt.Errorf("virtual sensor %v: unknown sensor %v", sensorId, ref.SensorId)
+				}
+				err := check(ref.SensorId)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		state[sensorId] = 2
+		return nil
+	}
+	for sensorId := range sensors {
+		err := check(sensorId)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate checks sensor properties and parses virtual sensor expressions
+func (s *Sensor) Validate() error {
+	for name, c := range s.Calibration {
+		err := c.Validate()
+		if err != nil {
+			return fmt.Errorf("sensor %v property %v: %v", s.Id, name, err.Error())
+		}
+	}
+	for name := range s.Offsets {
+		if len(name) == 0 {
+			return fmt.Errorf("sensor %v: empty offset property name", s.Id)
+		}
+	}
+	for deviceSensor, name := range s.DeviceSensors {
+		if len(name) == 0 {
+			return fmt.Errorf("sensor %v: empty device sensor %v name", s.Id, deviceSensor)
+		}
+		if deviceSensor < 0 || deviceSensor > 255 {
+			return fmt.Errorf("sensor %v: invalid device sensor index %v", s.Id, deviceSensor)
+		}
+	}
+	return s.parseExpressions()
+}
+
+// ValidateSensors checks references between sensors
+func ValidateSensors(sensors map[int]Sensor) error {
+	deviceSensors := make(map[[2]int]int)
+	for _, sensor := range sensors {
+		for deviceSensor := range sensor.DeviceSensors {
+			key := [2]int{sensor.DeviceId, deviceSensor}
+			id, ok := deviceSensors[key]
+			if ok {
+				return fmt.Errorf("device %v sensor %v is mapped to sensors %v and %v", sensor.DeviceId, deviceSensor,
+					id, sensor.Id)
+			}
+			deviceSensors[key] = sensor.Id
+		}
+	}
+	return validateVirtualSensors(sensors)
 }
 
 func ReadSensorsFromJson(path string) (map[int]Sensor, error) {
@@ -27,8 +144,35 @@ func ReadSensorsFromJson(path string) (map[int]Sensor, error) {
 
 	result := make(map[int]Sensor)
 	for _, l := range sensors {
+		err = l.Validate()
+		if err != nil {
+			return nil, err
+		}
 		result[l.Id] = l
 	}
 
+	err = ValidateSensors(result)
+	if err != nil {
+		return nil, err
+	}
+
 	return result, nil
 }
+
+// WriteSensorsToJson writes sensors sorted by id, file is replaced atomically
+func WriteSensorsToJson(path string, sensors map[int]Sensor) error {
+	var list []Sensor
+	for _, sensor := range sensors {
+		list = append(list, sensor)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Id < list[j].Id })
+	return writeJsonFile(path, list)
+}
+
+func writeJsonFile(path string, v any) error {
+	dat, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return files.ReplaceFile(path, dat)
+}
@@ -70,17 +70,47 @@ func ToPropertyMap(m map[string]interface{}) (PropertyMap, error) {
 }
 
 type SensorData struct {
+	// HHMMSS in server time zone
 	EventTime int
 	Data      PropertyMap
+	// unix time, 0 for data stored without it
+	Timestamp int64 `json:",omitempty"`
+}
+
+// returns true when both values have the same event time
+func (d *SensorData) SameTime(other *SensorData) bool {
+	if d.Timestamp != 0 && other.Timestamp != 0 {
+		return d.Timestamp == other.Timestamp
+	}
+	return d.EventTime == other.EventTime
 }
 
 type OutSensorData struct {
 	EventTime int
 	Data      OutPropertyMap
+	// set for the first empty time bucket after data
+	Gap bool `json:",omitempty"`
 }
 
 func ReadSensorDataFromJson(files []files.FileProvider) (map[int][]SensorData, error) {
 	result := make(map[int][]SensorData)
+	// column file first, json files override its data
+	for _, file := range files {
+		fileName := file.GetName()
+		if strings.HasSuffix(fileName, ".col") {
+			dat, err := file.Read()
+			if err != nil {
+				return nil, err
+			}
+			sensorData, err := DecodeColumnData(dat)
+			if err != nil {
+				return nil, fmt.Errorf("%v: %v", fileName, err.Error())
+			}
+			for sensorId, v := range sensorData {
+				result[sensorId] = v
+			}
+		}
+	}
 	for _, file := range files {
 		fileName := file.GetName()
 		if strings.HasSuffix(fileName, ".json") {
@@ -148,6 +178,19 @@ func WriteSensorDataToJson(dataFolder string, date int, sensorId int, data []Sen
 	return true
 }
 
+func WriteSensorDataToColumnFile(dataFolder string, date int, data map[int][]SensorData) error {
+	bytes, err := EncodeColumnData(data)
+	if err != nil {
+		return err
+	}
+	datePath := dataFolder + string(os.PathSeparator) + "dates_col"
+	err = os.MkdirAll(datePath, 0755)
+	if err != nil {
+		return err
+	}
+	return files.ReplaceFile(datePath+string(os.PathSeparator)+strconv.Itoa(date)+".col", bytes)
+}
+
 func convertValue(v float64) int {
 	return int(math.Round(v * 100))
 }
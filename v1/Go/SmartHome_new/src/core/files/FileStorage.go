@@ -2,13 +2,18 @@ package files
 
 import (
 	"archive/zip"
+	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 )
 
 const datesNew = "dates_new"
+const datesCol = "dates_col"
+const colFileExtension = ".col"
 
 type FileProvider interface {
 	GetName() string
@@ -46,31 +51,232 @@ func (p *zipFileProvider) Read() ([]byte, error) {
 	return io.ReadAll(f)
 }
 
+// Archived dates_new files are stored in per month zip files <zip file name>_<YYYYMM>.zip
+// next to the zip file, so archiving rewrites only zip files of archived months.
 type FileStorage struct {
-	Files     map[int][]FileProvider
-	zipReader *zip.ReadCloser
+	Files       map[int][]FileProvider
+	path        string
+	zipFileName string
+	columnDates map[int]bool
+	// map zip file name -> reader for the zip file and month zip files
+	zipReaders map[string]*zip.ReadCloser
 }
 
 func (s *FileStorage) Close() {
-	if s.zipReader != nil {
-		_ = s.zipReader.Close()
+	closeZipReaders(s.zipReaders)
+	s.zipReaders = nil
+}
+
+func closeZipReaders(readers map[string]*zip.ReadCloser) {
+	for _, reader := range readers {
+		_ = reader.Close()
 	}
 }
 
 func NewFileStorage(path, zipFileName string) (*FileStorage, error) {
-	fileMap := make(map[int]map[string]FileProvider)
-	err := buildOSFileMap(fileMap, path)
+	s := FileStorage{path: path, zipFileName: zipFileName}
+	err := s.load()
 	if err != nil {
 		return nil, err
 	}
-	reader, err := buildZipFileMap(fileMap, zipFileName)
+	return &s, nil
+}
+
+// builds the file index, the current index is kept when load fails
+func (s *FileStorage) load() error {
+	fileMap := make(map[int]map[string]FileProvider)
+	err := buildOSFileMap(fileMap, s.path)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	columnDates, err := buildColumnFileMap(fileMap, s.path)
+	if err != nil {
+		return err
+	}
+	readers, err := buildZipFileMap(fileMap, columnDates, s.zipFileName)
+	if err != nil {
+		return err
+	}
+	s.Close()
+	s.Files = buildFileMap(fileMap)
+	s.columnDates = columnDates
+	s.zipReaders = readers
+	return nil
+}
+
+func (s *FileStorage) HasColumnFile(date int) bool {
+	return s.columnDates[date]
+}
+
+func (s *FileStorage) datePath(date int) string {
+	return s.path + string(os.PathSeparator) + datesNew + string(os.PathSeparator) + strconv.Itoa(date)
+}
+
+// returns names of dates_new files for the date
+func (s *FileStorage) DatesNewFiles(date int) []string {
+	var result []string
+	for _, p := range s.Files[date] {
+		_, ok := p.(*osFileProvider)
+		if ok && !strings.HasSuffix(p.GetName(), colFileExtension) {
+			result = append(result, p.GetName())
+		}
+	}
+	return result
+}
+
+// moves dates_new files (map date -> file names) to month zip files, fails when zip file name is not set.
+// Dates having column file are not added to zip files because column file takes precedence,
+// caller should merge such files into the column file.
+func (s *FileStorage) Archive(files map[int][]string) error {
+	if len(files) == 0 {
+		return nil
+	}
+	if len(s.zipFileName) == 0 {
+		return fmt.Errorf("zip file name is not set")
+	}
+	err := s.addToZipFiles(files)
+	if err != nil {
+		return err
+	}
+	for date, names := range files {
+		datePath := s.datePath(date)
+		for _, name := range names {
+			err := os.Remove(datePath + string(os.PathSeparator) + name)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		// removed only when empty
+		_ = os.Remove(datePath)
+	}
+	return s.load()
+}
+
+func (s *FileStorage) monthZipFileName(month int) string {
+	return strings.TrimSuffix(s.zipFileName, ".zip") + "_" + strconv.Itoa(month) + ".zip"
+}
+
+func (s *FileStorage) addToZipFiles(files map[int][]string) error {
+	// map month -> map zip entry name -> file name
+	added := make(map[int]map[string]string)
+	for date, names := range files {
+		if s.columnDates[date] {
+			continue
+		}
+		month := date / 100
+		m, ok := added[month]
+		if !ok {
+			m = make(map[string]string)
+			added[month] = m
+		}
+		for _, name := range names {
+			m[datesNew+"/"+strconv.Itoa(date)+"/"+name] = s.datePath(date) + string(os.PathSeparator) + name
+		}
+	}
+	for month, m := range added {
+		err := s.addToZipFile(s.monthZipFileName(month), m)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *FileStorage) addToZipFile(zipFileName string, added map[string]string) error {
+	tmpFileName := zipFileName + ".tmp"
+	f, err := os.Create(tmpFileName)
+	if err != nil {
+		return err
+	}
+	w := zip.NewWriter(f)
+	reader, ok := s.zipReaders[zipFileName]
+	if ok {
+		err = copyZipFiles(w, reader.File, added)
+	}
+	if err == nil {
+		err = addZipFiles(w, added)
 	}
-	return &FileStorage{
-		Files:     buildFileMap(fileMap),
-		zipReader: reader,
-	}, nil
+	if err == nil {
+		err = w.Close()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmpFileName)
+		return err
+	}
+	if ok {
+		// zip file can't be replaced while it is open on Windows
+		_ = reader.Close()
+		delete(s.zipReaders, zipFileName)
+	}
+	err = os.Rename(tmpFileName, zipFileName)
+	if err != nil {
+		return err
+	}
+	// source files are removed after the zip file is durable
+	return SyncDir(filepath.Dir(zipFileName))
+}
+
+// copies zip file entries except replaced ones
+func copyZipFiles(w *zip.Writer, files []*zip.File, replaced map[string]string) error {
+	for _, file := range files {
+		_, ok := replaced[file.Name]
+		if ok {
+			continue
+		}
+		err := w.Copy(file)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addZipFiles(w *zip.Writer, files map[string]string) error {
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		dat, err := os.ReadFile(files[name])
+		if err != nil {
+			return err
+		}
+		fw, err := w.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = fw.Write(dat)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// adds dates_new files for the date to the index, existing providers with the same names are replaced
+func (s *FileStorage) UpdateDate(date int) error {
+	fileProviders, err := buildOSFileProviders(s.datePath(date))
+	if err != nil {
+		return err
+	}
+	for _, p := range s.Files[date] {
+		_, ok := fileProviders[p.GetName()]
+		if !ok {
+			fileProviders[p.GetName()] = p
+		}
+	}
+	if len(fileProviders) > 0 {
+		s.Files[date] = buildFileArray(fileProviders)
+	}
+	return nil
 }
 
 func buildFileMap(fileMap map[int]map[string]FileProvider) map[int][]FileProvider {
@@ -135,26 +341,95 @@ func buildOSFileProviders(path string) (map[string]FileProvider, error) {
 	return result, nil
 }
 
-func buildZipFileMap(fileMap map[int]map[string]FileProvider, zipFileName string) (*zip.ReadCloser, error) {
-	if zipFileName != "" {
-		reader, err := zip.OpenReader(zipFileName)
+// column files take precedence over zip file contents, dates_new files override column file data per sensor
+func buildColumnFileMap(fileMap map[int]map[string]FileProvider, path string) (map[int]bool, error) {
+	result := make(map[int]bool)
+	path += string(os.PathSeparator) + datesCol
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return result, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	files, err := f.Readdir(-1)
+	if err != nil {
+		return nil, err
+	}
+	for _, fi := range files {
+		name := fi.Name()
+		if fi.IsDir() || !strings.HasSuffix(name, colFileExtension) {
+			continue
+		}
+		date, err := strconv.Atoi(name[:len(name)-len(colFileExtension)])
 		if err != nil {
 			return nil, err
 		}
+		provider := &osFileProvider{fullName: path + string(os.PathSeparator) + name, fileName: name}
+		files, ok := fileMap[date]
+		if !ok {
+			fileMap[date] = map[string]FileProvider{name: provider}
+		} else {
+			files[name] = provider
+		}
+		result[date] = true
+	}
+	return result, nil
+}
+
+// month zip files are added before the zip file because they contain later versions of the same files
+func buildZipFileMap(fileMap map[int]map[string]FileProvider, columnDates map[int]bool,
+	zipFileName string) (map[string]*zip.ReadCloser, error) {
+	if zipFileName == "" {
+		return nil, nil
+	}
+	names, err := listMonthZipFiles(zipFileName)
+	if err != nil {
+		return nil, err
+	}
+	readers := make(map[string]*zip.ReadCloser)
+	for _, name := range append(names, zipFileName) {
+		reader, err := zip.OpenReader(name)
+		if err != nil {
+			closeZipReaders(readers)
+			return nil, err
+		}
+		readers[name] = reader
 		for _, file := range reader.File {
 			if !file.FileInfo().IsDir() {
-				err = addToFileMap(fileMap, file)
+				err = addToFileMap(fileMap, columnDates, file)
 				if err != nil {
+					closeZipReaders(readers)
 					return nil, err
 				}
 			}
 		}
-		return reader, nil
 	}
-	return nil, nil
+	return readers, nil
+}
+
+func listMonthZipFiles(zipFileName string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Dir(zipFileName))
+	if err != nil {
+		return nil, err
+	}
+	prefix := strings.TrimSuffix(filepath.Base(zipFileName), ".zip") + "_"
+	var result []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ".zip") {
+			continue
+		}
+		_, err := strconv.Atoi(name[len(prefix) : len(name)-4])
+		if err == nil {
+			result = append(result, strings.TrimSuffix(zipFileName, ".zip")+"_"+name[len(prefix):])
+		}
+	}
+	return result, nil
 }
 
-func addToFileMap(fileMap map[int]map[string]FileProvider, file *zip.File) error {
+func addToFileMap(fileMap map[int]map[string]FileProvider, columnDates map[int]bool, file *zip.File) error {
 	parts := strings.Split(file.Name, "/")
 	l := len(parts)
 	if l >= 2 {
@@ -164,6 +439,9 @@ func addToFileMap(fileMap map[int]map[string]FileProvider, file *zip.File) error
 		if err != nil {
 			return err
 		}
+		if columnDates[date] {
+			return nil
+		}
 		files, ok := fileMap[date]
 		if !ok {
 			fileMap[date] = map[string]FileProvider{fileName: &zipFileProvider{fileName: fileName, file: file}}
@@ -9,12 +9,20 @@ import (
 
 func main() {
 	l := len(os.Args)
-	if l != 2 {
-		fmt.Println("Usage: SmartHome_new iniFileName")
+	if l < 2 || (l == 3 && os.Args[2] != "convert") || (l > 3 && os.Args[2] != "export") {
+		fmt.Println("Usage: SmartHome_new iniFileName [convert]")
+		fmt.Println("       SmartHome_new iniFileName export -start YYYYMMDD -end YYYYMMDD [-format csv|columns] [-sensors 1,2] [-out fileName]")
 		os.Exit(1)
 	}
 
-	err := core.Run(os.Args[1])
+	var err error
+	if l > 3 {
+		err = core.Export(os.Args[1], os.Args[3:])
+	} else if l == 3 {
+		err = core.Convert(os.Args[1])
+	} else {
+		err = core.Run(os.Args[1])
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
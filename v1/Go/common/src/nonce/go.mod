@@ -0,0 +1,3 @@
+module nonce
+
+go 1.17
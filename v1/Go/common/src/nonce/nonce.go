@@ -0,0 +1,68 @@
+package nonce
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Nonce tracking shared by UDP servers.
+// Nonce contains client time in milliseconds in its last 6 bytes.
+// Nonces are accepted only within the window around server time and only once.
+
+const DefaultWindow = 60
+
+type Cache struct {
+	window uint64
+	// map nonce -> nonce time in milliseconds
+	seen  map[string]uint64
+	mutex sync.Mutex
+}
+
+// NewCache creates a cache with the window in seconds, DefaultWindow is used for windowSeconds <= 0
+func NewCache(windowSeconds int) *Cache {
+	if windowSeconds <= 0 {
+		windowSeconds = DefaultWindow
+	}
+	return &Cache{
+		window: uint64(windowSeconds) * 1000,
+		seen:   make(map[string]uint64),
+	}
+}
+
+func nonceTime(nonce []byte) uint64 {
+	return binary.LittleEndian.Uint64(nonce[len(nonce)-8:]) >> 16
+}
+
+func (c *Cache) inWindow(timePart uint64, millis uint64) bool {
+	return (timePart >= millis && (timePart-millis < c.window)) ||
+		(timePart < millis && (millis-timePart < c.window))
+}
+
+// CheckTime checks nonce time, to be used as AesDecode nonce validator
+func (c *Cache) CheckTime(nonce []byte) error {
+	if !c.inWindow(nonceTime(nonce), uint64(time.Now().UnixNano()/1000000)) {
+		return fmt.Errorf("incorrect nonce")
+	}
+	return nil
+}
+
+// Add remembers nonce of successfully decoded message, returns an error if it was already seen
+func (c *Cache) Add(nonce []byte) error {
+	millis := uint64(time.Now().UnixNano() / 1000000)
+	key := string(nonce)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for k, t := range c.seen {
+		if !c.inWindow(t, millis) {
+			delete(c.seen, k)
+		}
+	}
+	_, ok := c.seen[key]
+	if ok {
+		return fmt.Errorf("duplicate nonce")
+	}
+	c.seen[key] = nonceTime(nonce)
+	return nil
+}
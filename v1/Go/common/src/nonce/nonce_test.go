@@ -0,0 +1,46 @@
+package nonce
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func buildTestNonce(t time.Time, random byte) []byte {
+	nonce := make([]byte, 12)
+	nonce[0] = random
+	binary.LittleEndian.PutUint64(nonce[4:], uint64(t.UnixNano()/1000000)<<16)
+	return nonce
+}
+
+func TestNonceCache(t *testing.T) {
+	c := NewCache(10)
+	now := time.Now()
+	nonce := buildTestNonce(now, 1)
+	if err := c.CheckTime(nonce); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Add(nonce); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Add(nonce); err == nil {
+		t.Fatal("duplicate nonce should be rejected")
+	}
+	if err := c.Add(buildTestNonce(now, 2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.CheckTime(buildTestNonce(now.Add(-11*time.Second), 3)); err == nil {
+		t.Fatal("old nonce should be rejected")
+	}
+	if err := c.CheckTime(buildTestNonce(now.Add(11*time.Second), 3)); err == nil {
+		t.Fatal("future nonce should be rejected")
+	}
+	// expired nonces are removed from the cache
+	c.seen["old"] = uint64(now.Add(-time.Minute).UnixNano() / 1000000)
+	if err := c.Add(buildTestNonce(now, 4)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.seen["old"]; ok {
+		t.Fatal("expired nonce should be removed")
+	}
+}
@@ -3,3 +3,7 @@ module doorControl
 go 1.17
 
 require periph.io/x/periph v3.6.8+incompatible
+
+require nonce v0.0.0
+
+replace nonce => ../common/src/nonce
@@ -12,6 +12,7 @@ type configuration struct {
     KeyFile          string
     key              []byte
     UdpPort          int
+    NonceWindow      int
     FailOnUnknownPin bool
 }
 
@@ -10,3 +10,7 @@ require (
 )
 
 require github.com/davecgh/go-spew v1.1.1 // indirect
+
+require nonce v0.0.0
+
+replace nonce => ../common/src/nonce
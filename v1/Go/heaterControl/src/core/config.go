@@ -33,6 +33,7 @@ type configuration struct {
     KeyFile           string
     key               []byte
     UdpPort           int
+    NonceWindow       int
     SmartHomeUrl      string
     FailOnUnknownPin  bool
 }